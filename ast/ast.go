@@ -61,6 +61,43 @@ func (returnStmt ReturnStatement) String() string {
 func (returnStmt ReturnStatement) statementBehaviour() {
 }
 
+// ImportStatement includes the top-level definitions of another file into the current scope.
+type ImportStatement struct {
+	Token token.Token
+	Path  *StringLiteral
+}
+
+func (importStmt ImportStatement) TokenLiteral() string {
+	return importStmt.Token.Literal
+}
+
+func (importStmt ImportStatement) String() string {
+	var buf bytes.Buffer
+	buf.WriteString(importStmt.TokenLiteral() + " ")
+	buf.WriteString(importStmt.Path.String())
+	buf.WriteString(";")
+	return buf.String()
+}
+
+func (importStmt ImportStatement) statementBehaviour() {
+}
+
+// ImportExpression evaluates to a module object holding the top-level definitions of another file.
+type ImportExpression struct {
+	Token token.Token
+	Path  *StringLiteral
+}
+
+func (ie ImportExpression) expressionBehaviour() {}
+
+func (ie ImportExpression) String() string {
+	return ie.TokenLiteral() + "(" + ie.Path.String() + ")"
+}
+
+func (ie ImportExpression) TokenLiteral() string {
+	return ie.Token.Literal
+}
+
 type ExpressionStatement struct {
 	Token token.Token
 	Expr  Expression
@@ -213,6 +250,24 @@ func (iec IfElseConditional) TokenLiteral() string {
 	return iec.Token.Literal
 }
 
+// DoExpression is a block used as an expression. Its lets are local to the block and its value is that of its last
+// statement, null unless that is an expression.
+type DoExpression struct {
+	Token   token.Token
+	Body    *BlockStatement
+	Hoisted bool // its lets are visible to the whole block, like those of a program, as for the block of a module
+}
+
+func (de DoExpression) expressionBehaviour() {}
+
+func (de DoExpression) String() string {
+	return de.TokenLiteral() + " " + de.Body.String()
+}
+
+func (de DoExpression) TokenLiteral() string {
+	return de.Token.Literal
+}
+
 type LoopStatement struct {
 	Token     token.Token
 	Condition Expression
@@ -282,6 +337,35 @@ func (ie InfixExpression) TokenLiteral() string {
 	return ie.Token.Literal
 }
 
+// MatchExpression evaluates the body of the first arm whose pattern matches the subject.
+type MatchExpression struct {
+	Token   token.Token
+	Subject Expression
+	Arms    []*MatchArm
+}
+
+// MatchArm pairs a pattern with the expression evaluated when it matches. Patterns are integer, string and boolean
+// literals, identifiers binding the matched value ( _ matches anything without binding ), and array and hash
+// literals of patterns.
+type MatchArm struct {
+	Pattern Expression
+	Body    Expression
+}
+
+func (me MatchExpression) expressionBehaviour() {}
+
+func (me MatchExpression) String() string {
+	var arms []string
+	for _, arm := range me.Arms {
+		arms = append(arms, arm.Pattern.String()+" => "+arm.Body.String())
+	}
+	return fmt.Sprintf("match (%s) { %s }", me.Subject.String(), strings.Join(arms, "; "))
+}
+
+func (me MatchExpression) TokenLiteral() string {
+	return me.Token.Literal
+}
+
 type ArrayLiteral struct {
 	Token    token.Token
 	Elements []Expression
@@ -306,17 +390,24 @@ func (all ArrayLiteral) TokenLiteral() string {
 	return all.Token.Literal
 }
 
+// HashPair is a key and its value in a hash literal.
+type HashPair struct {
+	Key   Expression
+	Value Expression
+}
+
+// HashLiteral keeps its pairs in source order, so String gives back the literal as written.
 type HashLiteral struct {
 	Token token.Token
-	Pairs map[Expression]Expression
+	Pairs []HashPair
 }
 
 func (hl HashLiteral) expressionBehaviour() {}
 
 func (hl HashLiteral) String() string {
 	var pairs []string
-	for key, value := range hl.Pairs {
-		pairs = append(pairs, key.String()+": "+value.String())
+	for _, pair := range hl.Pairs {
+		pairs = append(pairs, pair.Key.String()+": "+pair.Value.String())
 	}
 	return fmt.Sprintf("{%s}", strings.Join(pairs, ", "))
 }
@@ -354,6 +445,19 @@ func (ce CallExpression) TokenLiteral() string {
 	return ce.Token.Literal
 }
 
+// Method returns the receiver and the name of a call written receiver.name(args), and false for any other call.
+func (ce CallExpression) Method() (Expression, string, bool) {
+	member, ok := ce.Function.(*IndexExpression)
+	if !ok || member.Token.Type != token.DOT {
+		return nil, "", false
+	}
+	name, ok := member.Index.(*StringLiteral)
+	if !ok {
+		return nil, "", false
+	}
+	return member.Left, name.Value, true
+}
+
 type IndexExpression struct {
 	Token token.Token
 	Left  Expression
@@ -404,6 +508,17 @@ func (prg Program) TokenLiteral() string {
 	}
 }
 
+// HasValue reports whether the program has a value, the value of its last statement, which is the case when that is an
+// expression statement. An empty program, like one of only comments, or a program ending with a let or a loop has none,
+// unless a return ends it early.
+func (prg Program) HasValue() bool {
+	if len(prg.Statements) == 0 {
+		return false
+	}
+	_, ok := prg.Statements[len(prg.Statements)-1].(*ExpressionStatement)
+	return ok
+}
+
 func (prg Program) String() string {
 	var buf bytes.Buffer
 
@@ -435,3 +550,50 @@ func (bs BlockStatement) String() string {
 
 // TODO: Is this a statement or an expression ?
 func (bs BlockStatement) statementBehaviour() {}
+
+// NodeToken returns the token locating node in the source, for the source map of the compiler and the errors of the
+// evaluator, or false when node has no source position.
+func NodeToken(node Node) (token.Token, bool) {
+	var tok token.Token
+	switch n := node.(type) {
+	case *LetStatement:
+		tok = n.Token
+	case *ReturnStatement:
+		tok = n.Token
+	case *ExpressionStatement:
+		tok = n.Token
+	case *LoopStatement:
+		tok = n.Token
+	case *CallExpression:
+		tok = n.Token
+	case *IndexExpression:
+		tok = n.Token
+	case *InfixExpression:
+		tok = n.Token
+	case *PrefixExpression:
+		tok = n.Token
+	case *IfElseConditional:
+		tok = n.Token
+	case *DoExpression:
+		tok = n.Token
+	case *MatchExpression:
+		tok = n.Token
+	case *FunctionLiteral:
+		tok = n.Token
+	case *ArrayLiteral:
+		tok = n.Token
+	case *HashLiteral:
+		tok = n.Token
+	case *Identifier:
+		tok = n.Token
+	case *IntegerLiteral:
+		tok = n.Token
+	case *StringLiteral:
+		tok = n.Token
+	case *BooleanLiteral:
+		tok = n.Token
+	default:
+		return tok, false
+	}
+	return tok, tok.Line != 0
+}
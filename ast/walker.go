@@ -4,6 +4,7 @@ type Modifier func(Node) (Node, error)
 
 // Walker walks the input AST and applies modifier to each node.
 // It returns an AST copy and does not mutate the input AST.
+// The body of a macro literal is not walked, it is only expanded once the macro is called.
 func Walker(node Node, modifier Modifier) (Node, error) {
 	if node == nil {
 		return nil, nil
@@ -32,6 +33,13 @@ func Walker(node Node, modifier Modifier) (Node, error) {
 			Token: n.Token,
 			Name:  n.Name, Right: mRight.(Expression)})
 
+	case *ReturnStatement:
+		mValue, err := Walker(n.Value, modifier)
+		if err != nil {
+			return nil, err
+		}
+		return modifier(&ReturnStatement{Token: n.Token, Value: mValue.(Expression)})
+
 	case *ExpressionStatement:
 		mExpr, err := Walker(n.Expr, modifier)
 		if err != nil {
@@ -80,6 +88,43 @@ func Walker(node Node, modifier Modifier) (Node, error) {
 			Token:    n.Token,
 			Function: mFunc.(Expression), Arguments: mArgs})
 
+	case *IndexExpression:
+		mLeft, err := Walker(n.Left, modifier)
+		if err != nil {
+			return nil, err
+		}
+		mIndex, err := Walker(n.Index, modifier)
+		if err != nil {
+			return nil, err
+		}
+		return modifier(&IndexExpression{Token: n.Token, Left: mLeft.(Expression), Index: mIndex.(Expression)})
+
+	case *ArrayLiteral:
+		mElements := make([]Expression, len(n.Elements))
+		for i, element := range n.Elements {
+			mElement, err := Walker(element, modifier)
+			if err != nil {
+				return nil, err
+			}
+			mElements[i] = mElement.(Expression)
+		}
+		return modifier(&ArrayLiteral{Token: n.Token, Elements: mElements})
+
+	case *HashLiteral:
+		mPairs := make([]HashPair, len(n.Pairs))
+		for i, pair := range n.Pairs {
+			mKey, err := Walker(pair.Key, modifier)
+			if err != nil {
+				return nil, err
+			}
+			mValue, err := Walker(pair.Value, modifier)
+			if err != nil {
+				return nil, err
+			}
+			mPairs[i] = HashPair{Key: mKey.(Expression), Value: mValue.(Expression)}
+		}
+		return modifier(&HashLiteral{Token: n.Token, Pairs: mPairs})
+
 	case *FunctionLiteral:
 		mParams := make([]*Identifier, len(n.Parameters))
 		for i, param := range n.Parameters {
@@ -118,6 +163,32 @@ func Walker(node Node, modifier Modifier) (Node, error) {
 			Token:     n.Token,
 			Condition: mCondition.(Expression), Consequence: mConsequence.(*BlockStatement), Alternative: mAlternative})
 
+	case *DoExpression:
+		mBody, err := Walker(n.Body, modifier)
+		if err != nil {
+			return nil, err
+		}
+		return modifier(&DoExpression{Token: n.Token, Body: mBody.(*BlockStatement), Hoisted: n.Hoisted})
+
+	case *MatchExpression:
+		mSubject, err := Walker(n.Subject, modifier)
+		if err != nil {
+			return nil, err
+		}
+		mArms := make([]*MatchArm, len(n.Arms))
+		for i, arm := range n.Arms {
+			mPattern, err := Walker(arm.Pattern, modifier)
+			if err != nil {
+				return nil, err
+			}
+			mBody, err := Walker(arm.Body, modifier)
+			if err != nil {
+				return nil, err
+			}
+			mArms[i] = &MatchArm{Pattern: mPattern.(Expression), Body: mBody.(Expression)}
+		}
+		return modifier(&MatchExpression{Token: n.Token, Subject: mSubject.(Expression), Arms: mArms})
+
 	case *LoopStatement:
 		mCondition, err := Walker(n.Condition, modifier)
 		if err != nil {
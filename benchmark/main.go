@@ -3,16 +3,18 @@ package main
 import (
 	"flag"
 	"fmt"
+	"github.com/jatin-malik/yal/ast"
 	"github.com/jatin-malik/yal/compiler"
 	"github.com/jatin-malik/yal/evaluator"
 	"github.com/jatin-malik/yal/lexer"
 	"github.com/jatin-malik/yal/object"
 	"github.com/jatin-malik/yal/parser"
 	"github.com/jatin-malik/yal/vm"
+	"os"
 	"time"
 )
 
-var engine = flag.String("engine", "", "engine to use ( vm or eval )")
+var engine = flag.String("engine", "", "engine to use ( vm, eval or both to compare them )")
 
 var benchmarkInput = `
 	let fibonacci = fn(x) {
@@ -28,6 +30,12 @@ var benchmarkInput = `
 	};
 	fibonacci(35);`
 
+// measurement is the result of running the benchmark program on one engine and how long it took.
+type measurement struct {
+	result   object.Object
+	duration time.Duration
+}
+
 func main() {
 	flag.Parse()
 
@@ -36,33 +44,99 @@ func main() {
 		return
 	}
 
-	var duration time.Duration
-
 	lexer := lexer.New(benchmarkInput)
 	parser := parser.New(lexer)
 	prg := parser.ParseProgram()
 
-	if *engine == "eval" {
+	var m measurement
+	var err error
+	switch *engine {
+	case "eval":
 		// use tree walking interpreter
-		env := object.NewEnvironment(nil)
-		start := time.Now()
-		obj := evaluator.Eval(prg, env)
-		duration = time.Since(start)
-		fmt.Println(obj.Inspect())
-	} else if *engine == "vm" {
+		m, err = runEval(prg)
+	case "vm":
 		// use bytecode compiler and vm
-		compiler := compiler.New()
-		start := time.Now()
-		compiler.Compile(prg)
-		code := compiler.Output()
-		vm := vm.NewStackVM(code.Instructions, code.ConstantPool)
-		vm.Run()
-		duration = time.Since(start)
-		fmt.Println(vm.Top().Inspect())
-	} else {
+		m, err = runVM(prg)
+	case "both":
+		var evalM, vmM measurement
+		evalM, vmM, err = compare(prg)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		fmt.Println(vmM.result.Inspect())
+		fmt.Printf("eval took %d ms.\n", evalM.duration.Milliseconds())
+		fmt.Printf("vm took %d ms.\n", vmM.duration.Milliseconds())
+		fmt.Printf("vm is %.2fx faster than eval.\n", speedup(evalM.duration, vmM.duration))
+		return
+	default:
 		fmt.Println("Unknown engine")
 		return
 	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	fmt.Println(m.result.Inspect())
+	fmt.Printf("Execution took %d ms.\n", m.duration.Milliseconds())
+}
+
+func runEval(prg *ast.Program) (measurement, error) {
+	env := object.NewEnvironment(nil)
+	start := time.Now()
+	obj := evaluator.Eval(prg, env)
+	duration := time.Since(start)
+	if errObj, ok := obj.(*object.Error); ok {
+		return measurement{}, fmt.Errorf("eval: %s", errObj.Message)
+	}
+	return measurement{result: obj, duration: duration}, nil
+}
+
+func runVM(prg *ast.Program) (measurement, error) {
+	compiler := compiler.New()
+	start := time.Now()
+	if err := compiler.Compile(prg); err != nil {
+		return measurement{}, fmt.Errorf("vm: %w", err)
+	}
+	code := compiler.Output()
+	vm := vm.NewStackVM(code.Instructions, code.ConstantPool)
+	if err := vm.Run(); err != nil {
+		return measurement{}, fmt.Errorf("vm: %w", err)
+	}
+	duration := time.Since(start)
+	return measurement{result: vm.Top(), duration: duration}, nil
+}
+
+// compare runs prg through both engines and fails if they do not produce the same result, so a benchmark run doubles as
+// a check that the engines agree.
+func compare(prg *ast.Program) (evalM, vmM measurement, err error) {
+	evalM, err = runEval(prg)
+	if err != nil {
+		return evalM, vmM, err
+	}
+	vmM, err = runVM(prg)
+	if err != nil {
+		return evalM, vmM, err
+	}
+	if err = checkSameResult(evalM.result, vmM.result); err != nil {
+		return evalM, vmM, err
+	}
+	return evalM, vmM, nil
+}
+
+func checkSameResult(evalResult, vmResult object.Object) error {
+	if !object.DeepEqual(evalResult, vmResult) {
+		return fmt.Errorf("engines diverge: eval gave %s %s, vm gave %s %s",
+			evalResult.Type(), evalResult.Inspect(), vmResult.Type(), vmResult.Inspect())
+	}
+	return nil
+}
 
-	fmt.Printf("Execution took %d ms.\n", duration.Milliseconds())
+// speedup returns how many times faster than the evaluator the vm ran.
+func speedup(evalDuration, vmDuration time.Duration) float64 {
+	if vmDuration <= 0 {
+		vmDuration = 1
+	}
+	return float64(evalDuration) / float64(vmDuration)
 }
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"github.com/jatin-malik/yal/lexer"
+	"github.com/jatin-malik/yal/object"
+	"github.com/jatin-malik/yal/parser"
+	"testing"
+	"time"
+)
+
+func TestCompare(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`let double = fn(x) { x * 2 }; double(21)`, "42"},
+		{`let f = fn(n) { if (n < 2) { return n; } f(n - 1) + f(n - 2) }; f(10)`, "55"},
+		{`[1, "two", {"three": 3}]`, `[1, two, {three:3}]`},
+		{`1 < 2`, "true"},
+		{`if (false) { 1 }`, "null"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			prg := parser.New(lexer.New(tt.input)).ParseProgram()
+			evalM, vmM, err := compare(prg)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if evalM.result.Inspect() != tt.expected || vmM.result.Inspect() != tt.expected {
+				t.Errorf("expected %s from both engines, got %s and %s", tt.expected, evalM.result.Inspect(), vmM.result.Inspect())
+			}
+		})
+	}
+
+	prg := parser.New(lexer.New(`1 + "a"`)).ParseProgram()
+	if _, _, err := compare(prg); err == nil {
+		t.Errorf("expected the runtime error to be reported")
+	}
+}
+
+func TestCheckSameResult(t *testing.T) {
+	if err := checkSameResult(&object.Integer{Value: 1}, &object.Integer{Value: 1}); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	err := checkSameResult(&object.Integer{Value: 1}, &object.String{Value: "1"})
+	expected := "engines diverge: eval gave INTEGER 1, vm gave STRING 1"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
+
+func TestSpeedup(t *testing.T) {
+	if got := speedup(3*time.Second, time.Second); got != 3 {
+		t.Errorf("expected 3, got %v", got)
+	}
+	if got := speedup(time.Second, 0); got <= 0 {
+		t.Errorf("expected a positive ratio for a zero vm duration, got %v", got)
+	}
+}
@@ -5,11 +5,16 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"github.com/jatin-malik/yal/token"
 )
 
 type Instructions []byte
 type OpCode byte
 
+// SourceMap maps the offset of an instruction to the token of the source node it was compiled from. Instructions
+// without a known position, like those of synthetic nodes, are left out.
+type SourceMap map[int]token.Token
+
 const (
 	OpPush OpCode = iota
 	OpAdd
@@ -39,107 +44,123 @@ const (
 	OpGetFree
 	OpClosure
 	OpGetCurrentClosure
+	OpError
+	OpMatch
+	OpPop
+	OpCallMethod
+	OpGetGlobalOrBuiltIn
 )
 
+// Definition describes an opcode: its readable name and the width in bytes of each of its operands.
+type Definition struct {
+	Name          string
+	OperandWidths []int
+}
+
+var definitions = map[OpCode]Definition{
+	OpPush:              {"OpPush", []int{2}},
+	OpAdd:               {"OpAdd", []int{}},
+	OpSub:               {"OpSub", []int{}},
+	OpMul:               {"OpMul", []int{}},
+	OpDiv:               {"OpDiv", []int{}},
+	OpPushTrue:          {"OpPushTrue", []int{}},
+	OpPushFalse:         {"OpPushFalse", []int{}},
+	OpEqual:             {"OpEqual", []int{}},
+	OpNotEqual:          {"OpNotEqual", []int{}},
+	OpGT:                {"OpGT", []int{}},
+	OpNegateBoolean:     {"OpNegateBoolean", []int{}},
+	OpNegateNumber:      {"OpNegateNumber", []int{}},
+	OpJumpIfFalse:       {"OpJumpIfFalse", []int{2}},
+	OpJump:              {"OpJump", []int{2}},
+	OpPushNull:          {"OpPushNull", []int{}},
+	OpSetGlobal:         {"OpSetGlobal", []int{2}},
+	OpGetGlobal:         {"OpGetGlobal", []int{2}},
+	OpArray:             {"OpArray", []int{2}},
+	OpHash:              {"OpHash", []int{2}},
+	OpIndex:             {"OpIndex", []int{}},
+	OpCall:              {"OpCall", []int{1}},
+	OpReturnValue:       {"OpReturnValue", []int{}},
+	OpSetLocal:          {"OpSetLocal", []int{2}},
+	OpGetLocal:          {"OpGetLocal", []int{2}},
+	OpGetBuiltIn:        {"OpGetBuiltIn", []int{1}},
+	OpGetFree:           {"OpGetFree", []int{1}},
+	OpClosure:           {"OpClosure", []int{2, 1}},
+	OpGetCurrentClosure: {"OpGetCurrentClosure", []int{}},
+	OpError:             {"OpError", []int{2}},         // fails with the message at the constant index
+	OpMatch:             {"OpMatch", []int{2}},         // matches the popped value against the pattern at the constant index
+	OpPop:               {"OpPop", []int{}},            // discards the value on top of the stack
+	OpCallMethod:        {"OpCallMethod", []int{2, 1}}, // calls receiver.name(args), name at the constant index
+	// reads a global shadowing a builtin, the builtin while the let of the global has not run
+	OpGetGlobalOrBuiltIn: {"OpGetGlobalOrBuiltIn", []int{2, 1}},
+}
+
+// Lookup returns the definition of op.
+func Lookup(op OpCode) (Definition, error) {
+	def, ok := definitions[op]
+	if !ok {
+		return Definition{}, fmt.Errorf("unknown opcode: %d", op)
+	}
+	return def, nil
+}
+
 func (op OpCode) String() string {
-	switch op {
-	case OpPush:
-		return "OpPush"
-	case OpAdd:
-		return "OpAdd"
-	case OpSub:
-		return "OpSub"
-	case OpMul:
-		return "OpMul"
-	case OpDiv:
-		return "OpDiv"
-	case OpPushTrue:
-		return "OpPushTrue"
-	case OpPushFalse:
-		return "OpPushFalse"
-	case OpEqual:
-		return "OpEqual"
-	case OpNotEqual:
-		return "OpNotEqual"
-	case OpGT:
-		return "OpGT"
-	case OpNegateBoolean:
-		return "OpNegateBoolean"
-	case OpNegateNumber:
-		return "OpNegateNumber"
-	case OpJumpIfFalse:
-		return "OpJumpIfFalse"
-	case OpJump:
-		return "OpJump"
-	case OpPushNull:
-		return "OpPushNull"
-	case OpSetGlobal:
-		return "OpSetGlobal"
-	case OpGetGlobal:
-		return "OpGetGlobal"
-	case OpArray:
-		return "OpArray"
-	case OpHash:
-		return "OpHash"
-	case OpIndex:
-		return "OpIndex"
-	case OpCall:
-		return "OpCall"
-	case OpReturnValue:
-		return "OpReturnValue"
-	case OpSetLocal:
-		return "OpSetLocal"
-	case OpGetLocal:
-		return "OpGetLocal"
-	case OpGetBuiltIn:
-		return "OpGetBuiltIn"
-	case OpGetFree:
-		return "OpGetFree"
-	case OpClosure:
-		return "OpClosure"
-	case OpGetCurrentClosure:
-		return "OpGetCurrentClosure"
-	default:
-		return fmt.Sprintf("OpCode(%d)", op)
+	if def, ok := definitions[op]; ok {
+		return def.Name
 	}
+	return fmt.Sprintf("OpCode(%d)", op)
 }
 
 // Make generates a bytecode instruction from the input opCode and operands. Multibyte operands are encoded in
 // BigEndian order.
 func Make(opCode OpCode, operands ...int) ([]byte, error) {
+	def, err := Lookup(opCode)
+	if err != nil {
+		return nil, err
+	}
+	if len(operands) != len(def.OperandWidths) {
+		return nil, fmt.Errorf("%s needs %d operands, got %d", opCode, len(def.OperandWidths), len(operands))
+	}
+
 	var instructions bytes.Buffer
 	instructions.WriteByte(byte(opCode))
-	switch opCode {
-	case OpPush, OpJumpIfFalse, OpJump, OpSetGlobal, OpGetGlobal, OpArray, OpHash, OpSetLocal, OpGetLocal:
-		if len(operands) != 1 {
-			return nil, fmt.Errorf("%s needs one operand", opCode)
+	for i, operand := range operands {
+		switch def.OperandWidths[i] {
+		case 1:
+			instructions.WriteByte(byte(operand))
+		case 2:
+			var operandBytes [2]byte
+			binary.BigEndian.PutUint16(operandBytes[:], uint16(operand))
+			instructions.Write(operandBytes[:])
 		}
-		idx := operands[0]
-		var operandBytes [2]byte
-		binary.BigEndian.PutUint16(operandBytes[:], uint16(idx))
-		instructions.Write(operandBytes[:])
-	case OpAdd, OpSub, OpMul, OpDiv, OpPushTrue, OpPushFalse, OpEqual, OpNotEqual, OpGT, OpNegateBoolean,
-		OpNegateNumber, OpPushNull, OpIndex, OpReturnValue, OpGetCurrentClosure:
-	case OpCall, OpGetBuiltIn, OpGetFree:
-		if len(operands) != 1 {
-			return nil, fmt.Errorf("%s needs one operand", opCode)
-		}
-		argsCount := operands[0]
-		instructions.WriteByte(byte(argsCount))
-	case OpClosure:
-		if len(operands) != 2 {
-			return nil, fmt.Errorf("%s needs one operand", opCode)
-		}
-		idx := operands[0]
-		var operandBytes [2]byte
-		binary.BigEndian.PutUint16(operandBytes[:], uint16(idx))
-		instructions.Write(operandBytes[:])
-
-		freeCount := operands[1]
-		instructions.WriteByte(byte(freeCount))
-	default:
-		return nil, fmt.Errorf("unknown opcode: %d", opCode)
 	}
 
 	return instructions.Bytes(), nil
 }
+
+// ReadOperands decodes the operands of an instruction described by def from ins, which starts right after the
+// opcode. It returns the operands and the number of bytes they occupy.
+func ReadOperands(def Definition, ins Instructions) ([]int, int) {
+	operands := make([]int, len(def.OperandWidths))
+	offset := 0
+	for i, width := range def.OperandWidths {
+		switch width {
+		case 1:
+			operands[i] = int(ReadUint8(ins[offset:]))
+		case 2:
+			operands[i] = int(ReadUint16(ins[offset:]))
+		}
+		offset += width
+	}
+	return operands, offset
+}
+
+// ReadUint16 decodes a 2-byte operand at the start of ins. Unlike ReadOperands it does not allocate, which suits the
+// VM's fetch loop.
+func ReadUint16(ins Instructions) uint16 {
+	return binary.BigEndian.Uint16(ins)
+}
+
+// ReadUint8 decodes a 1-byte operand at the start of ins.
+func ReadUint8(ins Instructions) uint8 {
+	return ins[0]
+}
@@ -76,3 +76,78 @@ func TestMake(t *testing.T) {
 		})
 	}
 }
+
+func TestMakeReadOperandsRoundTrip(t *testing.T) {
+	for opCode, def := range definitions {
+		t.Run(def.Name, func(t *testing.T) {
+			operands := make([]int, len(def.OperandWidths))
+			for i, width := range def.OperandWidths {
+				operands[i] = 1<<(8*width) - 1 - i // largest value that fits, made distinct per operand
+			}
+
+			ins, err := Make(opCode, operands...)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if OpCode(ins[0]) != opCode {
+				t.Errorf("expected opcode %s, got %s", opCode, OpCode(ins[0]))
+			}
+
+			decoded, read := ReadOperands(def, ins[1:])
+			if read != len(ins)-1 {
+				t.Errorf("expected to read %d bytes, read %d", len(ins)-1, read)
+			}
+			if fmt.Sprint(decoded) != fmt.Sprint(operands) {
+				t.Errorf("expected operands %v, got %v", operands, decoded)
+			}
+		})
+	}
+}
+
+func TestReadOperands(t *testing.T) {
+	tests := []struct {
+		opCode    OpCode
+		ins       Instructions // operand bytes following the opcode
+		expected  []int
+		bytesRead int
+	}{
+		{OpPush, Instructions{0x12, 0x34}, []int{0x1234}, 2},
+		{OpJumpIfFalse, Instructions{0x00, 0x0A}, []int{10}, 2},
+		{OpJump, Instructions{0x00, 0x0B}, []int{11}, 2},
+		{OpSetGlobal, Instructions{0xFF, 0xFF}, []int{65535}, 2},
+		{OpGetGlobal, Instructions{0x00, 0x01}, []int{1}, 2},
+		{OpArray, Instructions{0x00, 0x03}, []int{3}, 2},
+		{OpHash, Instructions{0x00, 0x04}, []int{4}, 2},
+		{OpSetLocal, Instructions{0x01, 0x00}, []int{256}, 2},
+		{OpGetLocal, Instructions{0x00, 0x00}, []int{0}, 2},
+		{OpCall, Instructions{0x02}, []int{2}, 1},
+		{OpGetBuiltIn, Instructions{0x0B}, []int{11}, 1},
+		{OpGetFree, Instructions{0xFF}, []int{255}, 1},
+		{OpClosure, Instructions{0x00, 0x05, 0x02}, []int{5, 2}, 3},
+		{OpAdd, Instructions{}, []int{}, 0},
+		{OpIndex, Instructions{0x00}, []int{}, 0}, // trailing bytes belong to the next instruction
+		{OpGetCurrentClosure, Instructions{}, []int{}, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.opCode.String(), func(t *testing.T) {
+			def, err := Lookup(tt.opCode)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			operands, read := ReadOperands(def, tt.ins)
+			if read != tt.bytesRead {
+				t.Errorf("expected to read %d bytes, read %d", tt.bytesRead, read)
+			}
+			if fmt.Sprint(operands) != fmt.Sprint(tt.expected) {
+				t.Errorf("expected operands %v, got %v", tt.expected, operands)
+			}
+		})
+	}
+}
+
+func TestLookupUnknownOpCode(t *testing.T) {
+	if _, err := Lookup(0xFF); err == nil {
+		t.Errorf("expected error but got nil")
+	}
+}
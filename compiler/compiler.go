@@ -5,16 +5,21 @@ import (
 	"github.com/jatin-malik/yal/ast"
 	"github.com/jatin-malik/yal/bytecode"
 	"github.com/jatin-malik/yal/object"
+	"github.com/jatin-malik/yal/token"
 )
 
 type CompilationScope struct {
 	instructions       bytecode.Instructions
+	sourceMap          bytecode.SourceMap
 	lastAddedInsOffset int
+	bound              map[string]bool // names bound so far by a let or as a parameter, for rebinding warnings
 }
 
 func NewCompilationScope() *CompilationScope {
 	return &CompilationScope{
 		instructions: bytecode.Instructions{},
+		sourceMap:    bytecode.SourceMap{},
+		bound:        map[string]bool{},
 	}
 }
 
@@ -23,12 +28,44 @@ type Compiler struct {
 	activeScopeIdx int
 	constantPool   []object.Object
 	symbolTable    *SymbolTable
+	strict         bool
+	warn           bool
+	lateGlobals    bool
+	warnings       []*Warning
+	position       token.Token // token of the innermost node being compiled that has a source position
+	functions      int         // number of function literals compiled, to tell whether a block defines any
+
+	// literalGlobals maps the index of each global last bound by a top level let to a non-function literal to the
+	// type of the literal, so calling it can be reported at compile time
+	literalGlobals map[int]object.ObjectType
 }
 
 // ByteCode encloses the output of the compiler
 type ByteCode struct {
 	Instructions bytecode.Instructions
 	ConstantPool []object.Object
+	SourceMap    bytecode.SourceMap
+}
+
+// Error is a compilation error reported at the token of the offending node.
+type Error struct {
+	Token   token.Token
+	Message string
+}
+
+func (err *Error) Error() string {
+	return err.Message
+}
+
+func newError(tok token.Token, format string, args ...any) *Error {
+	return &Error{Token: tok, Message: fmt.Sprintf(format, args...)}
+}
+
+// Warning is a likely mistake found while compiling that does not fail the compilation, reported at the token of the
+// offending node.
+type Warning struct {
+	Token   token.Token
+	Message string
 }
 
 type Option func(*Compiler)
@@ -46,43 +83,88 @@ func WithConstantPool(constantPool []object.Object) Option {
 	}
 }
 
-func New(options ...Option) *Compiler {
-	var scopes []*CompilationScope
-	scopes = append(scopes, NewCompilationScope())
-	compiler := &Compiler{
-		scopes:       scopes,
-		constantPool: []object.Object{},
-		symbolTable:  NewSymbolTable(nil),
+// WithStrict makes an if without else fail at runtime, instead of producing null, when its value is used and its
+// condition is false.
+func WithStrict() Option {
+	return func(c *Compiler) {
+		c.strict = true
+	}
+}
+
+// WithWarnings makes the compiler collect warnings, read through Warnings, for a let rebinding a name already bound in
+// the same scope. Rebinding is allowed, as in the evaluator, but an accidental one hides bugs.
+func WithWarnings() Option {
+	return func(c *Compiler) {
+		c.warn = true
+	}
+}
+
+// WithLateGlobals makes an unknown identifier in a function a global instead of a compile error, so the function can
+// refer to a global bound by a program compiled later with the same symbol table, as in the REPL. Calling the function
+// before that fails at runtime, like in the evaluator.
+func WithLateGlobals() Option {
+	return func(c *Compiler) {
+		c.lateGlobals = true
 	}
+}
+
+func New(options ...Option) *Compiler {
+	compiler := &Compiler{}
+	compiler.Reset(options...)
+	return compiler
+}
+
+// Reset discards all compilation state so the compiler can be reused for an unrelated program, leaving it as New
+// would. A symbol table or constant pool set through options earlier is discarded too; to keep sharing them, pass the
+// options again. Bytecode returned by Output before the reset is not affected.
+func (compiler *Compiler) Reset(options ...Option) {
+	compiler.scopes = append(compiler.scopes[:0], NewCompilationScope())
+	compiler.activeScopeIdx = 0
+	compiler.constantPool = []object.Object{}
+	compiler.symbolTable = NewSymbolTable(nil)
+	compiler.strict = false
+	compiler.warn = false
+	compiler.lateGlobals = false
+	compiler.warnings = nil
+	compiler.position = token.Token{}
+	compiler.functions = 0
+	compiler.literalGlobals = make(map[int]object.ObjectType)
 
 	// Apply provided options
 	for _, option := range options {
 		option(compiler)
 	}
-
-	return compiler
 }
 
 // Compile walks through the input AST and generates bytecode. It also populates the constant pool as it evaluates
 // constant literals in the AST. It returns an error in case compilation fails.
 func (compiler *Compiler) Compile(node ast.Node) error {
+	defer compiler.at(node)()
+
 	activeScope := compiler.scopes[compiler.activeScopeIdx]
 	switch n := node.(type) {
 	case *ast.Program:
-		for _, stmt := range n.Statements {
-			err := compiler.Compile(stmt)
-			if err != nil {
+		// Hoist the top level names, so that like in the evaluator functions can refer to globals defined further down.
+		// A global shadowing a builtin is read as the builtin until its let runs, see loadSymbol.
+		compiler.hoist(n.Statements)
+		for i, stmt := range n.Statements {
+			if err := compiler.checkCall(stmt); err != nil {
 				return err
 			}
-		}
-	case *ast.BlockStatement:
-		for _, stmt := range n.Statements {
 			err := compiler.Compile(stmt)
 			if err != nil {
 				return err
 			}
+			compiler.recordLiteralGlobal(stmt)
+			if _, ok := stmt.(*ast.ExpressionStatement); ok && i < len(n.Statements)-1 {
+				// only the value of the last statement is the value of the program, see ast.Program.HasValue
+				compiler.emit(bytecode.OpPop)
+			}
 		}
+	case *ast.BlockStatement:
+		return compiler.compileBlock(n, false)
 	case *ast.LetStatement:
+		compiler.bind(n.Name)
 		var symbol Symbol
 		if fl, ok := n.Right.(*ast.FunctionLiteral); ok {
 			// Register function name first to allow recursive functions
@@ -103,7 +185,15 @@ func (compiler *Compiler) Compile(node ast.Node) error {
 		}
 
 		compiler.storeSymbol(symbol)
+		if symbol.Scope == GLOBAL {
+			// a let anywhere but at the top level may or may not run, so the global is no longer known
+			delete(compiler.literalGlobals, symbol.Index)
+		}
 
+	case *ast.ImportStatement:
+		return newError(n.Token, "unresolved import %s", n.Path)
+	case *ast.ImportExpression:
+		return newError(n.Token, "unresolved import %s", n.Path)
 	case *ast.ReturnStatement:
 		err := compiler.Compile(n.Value)
 		if err != nil {
@@ -111,43 +201,13 @@ func (compiler *Compiler) Compile(node ast.Node) error {
 		}
 		compiler.emit(bytecode.OpReturnValue)
 	case *ast.ExpressionStatement:
-		err := compiler.Compile(n.Expr)
-		if err != nil {
-			return err
-		}
+		return compiler.compileExpression(n.Expr, false)
 	case *ast.IfElseConditional:
-		err := compiler.Compile(n.Condition)
-		if err != nil {
-			return err
-		}
-
-		compiler.emit(bytecode.OpJumpIfFalse, 9999)
-
-		conditionalJumpOffset := activeScope.lastAddedInsOffset
-
-		err = compiler.Compile(n.Consequence)
-		if err != nil {
-			return err
-		}
-
-		compiler.emit(bytecode.OpJump, 9999)
-		jumpOffset := activeScope.lastAddedInsOffset
-
-		// Back-patch conditional jump
-		newConditionalJumpIns, _ := bytecode.Make(bytecode.OpJumpIfFalse, len(activeScope.instructions))
-		compiler.modifyInstruction(conditionalJumpOffset, newConditionalJumpIns)
-
-		if n.Alternative != nil {
-			err = compiler.Compile(n.Alternative)
-			if err != nil {
-				return err
-			}
-		} else {
-			compiler.emit(bytecode.OpPushNull)
-		}
-
-		newJumpIns, _ := bytecode.Make(bytecode.OpJump, len(activeScope.instructions))
-		compiler.modifyInstruction(jumpOffset, newJumpIns)
+		return compiler.compileIfElseConditional(n, true)
+	case *ast.DoExpression:
+		return compiler.compileDoExpression(n, true)
+	case *ast.MatchExpression:
+		return compiler.compileMatchExpression(n, true)
 	case *ast.LoopStatement:
 		conditionOffset := len(activeScope.instructions)
 		err := compiler.Compile(n.Condition)
@@ -178,12 +238,12 @@ func (compiler *Compiler) Compile(node ast.Node) error {
 
 		compiler.emit(bytecode.OpArray, len(n.Elements))
 	case *ast.HashLiteral:
-		for k, v := range n.Pairs {
-			err := compiler.Compile(v)
+		for _, pair := range n.Pairs {
+			err := compiler.Compile(pair.Value)
 			if err != nil {
 				return err
 			}
-			err = compiler.Compile(k)
+			err = compiler.Compile(pair.Key)
 			if err != nil {
 				return err
 			}
@@ -202,6 +262,7 @@ func (compiler *Compiler) Compile(node ast.Node) error {
 
 		compiler.emit(bytecode.OpIndex)
 	case *ast.FunctionLiteral:
+		compiler.functions++
 		compiler.enterScope()
 		activeScope := compiler.scopes[compiler.activeScopeIdx]
 
@@ -210,6 +271,7 @@ func (compiler *Compiler) Compile(node ast.Node) error {
 		compiler.symbolTable = localSymbolTable
 
 		for _, param := range n.Parameters {
+			compiler.bind(param)
 			compiler.symbolTable.Define(param.Value)
 		}
 
@@ -217,7 +279,8 @@ func (compiler *Compiler) Compile(node ast.Node) error {
 			localSymbolTable.DefineFunctionSymbol(n.Name)
 		}
 
-		err := compiler.Compile(n.Body)
+		// the last statement of the body is the value the function returns
+		err := compiler.compileBlock(n.Body, true)
 		if err != nil {
 			return err
 		}
@@ -229,16 +292,22 @@ func (compiler *Compiler) Compile(node ast.Node) error {
 		}
 
 		if bytecode.OpCode(activeScope.instructions[activeScope.lastAddedInsOffset]) != bytecode.OpReturnValue {
-			// implicit return
+			// implicit return, mapped to the source of the value it returns rather than to the fn keyword
+			valueOffset := activeScope.lastAddedInsOffset
 			compiler.emit(bytecode.OpReturnValue)
+			if tok, ok := activeScope.sourceMap[valueOffset]; ok {
+				activeScope.sourceMap[activeScope.lastAddedInsOffset] = tok
+			}
 		}
 		compiledInstructions := activeScope.instructions
+		sourceMap := activeScope.sourceMap
 
 		compiler.symbolTable = localSymbolTable.outer
 		compiler.exitScope()
 
 		compiledFunctionObj := &object.CompiledFunction{
 			Instructions: compiledInstructions,
+			SourceMap:    sourceMap,
 			NumLocals:    localSymbolTable.len(),
 			NumParams:    len(n.Parameters),
 		}
@@ -252,6 +321,11 @@ func (compiler *Compiler) Compile(node ast.Node) error {
 		compiler.emit(bytecode.OpClosure, idx, len(localSymbolTable.freeSymbols))
 
 	case *ast.CallExpression:
+		if receiver, name, ok := n.Method(); ok {
+			if _, ok := builtInSymbols[name]; ok {
+				return compiler.compileMethodCall(n, receiver, name)
+			}
+		}
 		err := compiler.Compile(n.Function)
 		if err != nil {
 			return err
@@ -277,7 +351,7 @@ func (compiler *Compiler) Compile(node ast.Node) error {
 		case "-":
 			compiler.emit(bytecode.OpNegateNumber)
 		default:
-			return fmt.Errorf("unknown operator %s", n.Operator)
+			return newError(n.Token, "unknown operator %s", n.Operator)
 		}
 	case *ast.InfixExpression:
 
@@ -321,13 +395,19 @@ func (compiler *Compiler) Compile(node ast.Node) error {
 			case ">":
 				compiler.emit(bytecode.OpGT)
 			default:
-				return fmt.Errorf("unknown operator %s", n.Operator)
+				return newError(n.Token, "unknown operator %s", n.Operator)
 			}
 		}
 	case *ast.Identifier:
 		symbol, exists := compiler.symbolTable.Lookup(n.Value)
+		if !exists && compiler.lateGlobals && compiler.symbolTable.owner().outer != nil {
+			symbol, exists = compiler.symbolTable.global().Define(n.Value), true
+		}
 		if !exists {
-			return fmt.Errorf("unknown identifier %s", n.Value)
+			if suggestion, ok := object.ClosestName(n.Value, compiler.symbolTable.names()); ok {
+				return newError(n.Token, "unknown identifier %s, did you mean '%s'?", n.Value, suggestion)
+			}
+			return newError(n.Token, "unknown identifier %s", n.Value)
 		}
 		compiler.loadSymbol(symbol)
 
@@ -349,6 +429,284 @@ func (compiler *Compiler) Compile(node ast.Node) error {
 	return nil
 }
 
+// at makes the instructions emitted until the returned function is called map back to node, if it has a source
+// position. Instructions emitted for a node after its children map back to it again.
+func (compiler *Compiler) at(node ast.Node) func() {
+	tok, ok := ast.NodeToken(node)
+	if !ok {
+		return func() {}
+	}
+	enclosing := compiler.position
+	compiler.position = tok
+	return func() { compiler.position = enclosing }
+}
+
+// compileExpression compiles expr, whose value is used when asValue is set. That matters for an if without else, which
+// fails in strict mode when used, and for the expressions whose value is that of an if, a do block or a match arm.
+func (compiler *Compiler) compileExpression(expr ast.Expression, asValue bool) error {
+	switch expr := expr.(type) {
+	case *ast.IfElseConditional:
+		defer compiler.at(expr)()
+		return compiler.compileIfElseConditional(expr, asValue)
+	case *ast.DoExpression:
+		defer compiler.at(expr)()
+		return compiler.compileDoExpression(expr, asValue)
+	case *ast.MatchExpression:
+		defer compiler.at(expr)()
+		return compiler.compileMatchExpression(expr, asValue)
+	}
+	return compiler.Compile(expr)
+}
+
+// compileBlock compiles the statements of block, the value of the last one used when asValue is set.
+func (compiler *Compiler) compileBlock(block *ast.BlockStatement, asValue bool) error {
+	for i, stmt := range block.Statements {
+		err := compiler.compileStatement(stmt, asValue && i == len(block.Statements)-1)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// compileStatement compiles stmt, the value of an expression statement used when asValue is set.
+func (compiler *Compiler) compileStatement(stmt ast.Statement, asValue bool) error {
+	if exprStmt, ok := stmt.(*ast.ExpressionStatement); ok && asValue {
+		defer compiler.at(exprStmt)()
+		return compiler.compileExpression(exprStmt.Expr, true)
+	}
+	return compiler.Compile(stmt)
+}
+
+// compileIfElseConditional compiles an if expression. A missing else produces null, or in strict mode an error when
+// asValue reports that the result is used.
+func (compiler *Compiler) compileIfElseConditional(n *ast.IfElseConditional, asValue bool) error {
+	activeScope := compiler.scopes[compiler.activeScopeIdx]
+	err := compiler.Compile(n.Condition)
+	if err != nil {
+		return err
+	}
+
+	compiler.emit(bytecode.OpJumpIfFalse, 9999)
+
+	conditionalJumpOffset := activeScope.lastAddedInsOffset
+
+	err = compiler.compileBlock(n.Consequence, asValue)
+	if err != nil {
+		return err
+	}
+
+	compiler.emit(bytecode.OpJump, 9999)
+	jumpOffset := activeScope.lastAddedInsOffset
+
+	// Back-patch conditional jump
+	newConditionalJumpIns, _ := bytecode.Make(bytecode.OpJumpIfFalse, len(activeScope.instructions))
+	compiler.modifyInstruction(conditionalJumpOffset, newConditionalJumpIns)
+
+	if n.Alternative != nil {
+		err = compiler.compileBlock(n.Alternative, asValue)
+		if err != nil {
+			return err
+		}
+	} else if compiler.strict && asValue {
+		msg := compiler.addConstant(&object.String{Value: "if without else has no value: condition is false"})
+		compiler.emit(bytecode.OpError, msg)
+	} else {
+		compiler.emit(bytecode.OpPushNull)
+	}
+
+	newJumpIns, _ := bytecode.Make(bytecode.OpJump, len(activeScope.instructions))
+	compiler.modifyInstruction(jumpOffset, newJumpIns)
+	return nil
+}
+
+// compileDoExpression compiles the block of a do expression with its own symbol table, so its lets shadow the enclosing
+// names instead of rebinding them, while taking their slots from the enclosing function or program. Only the value of
+// the last statement is left on the stack, null unless that is an expression, and used when asValue is set.
+func (compiler *Compiler) compileDoExpression(n *ast.DoExpression, asValue bool) error {
+	defer compiler.enterBlock()()
+	if n.Hoisted {
+		compiler.hoist(n.Body.Statements)
+	}
+
+	statements := n.Body.Statements
+	if len(statements) == 0 {
+		compiler.emit(bytecode.OpPushNull)
+		return nil
+	}
+	for i, stmt := range statements {
+		last := i == len(statements)-1
+		err := compiler.compileStatement(stmt, asValue && last)
+		if err != nil {
+			return err
+		}
+		_, isExpression := stmt.(*ast.ExpressionStatement)
+		if isExpression && !last {
+			compiler.emit(bytecode.OpPop)
+		} else if !isExpression && last {
+			compiler.emit(bytecode.OpPushNull)
+		}
+	}
+	return nil
+}
+
+// hoist defines the names bound by the lets among statements, including those of the blocks an import statement is
+// replaced by, so they can be referred to before their let.
+func (compiler *Compiler) hoist(statements []ast.Statement) {
+	for _, stmt := range statements {
+		switch stmt := stmt.(type) {
+		case *ast.LetStatement:
+			compiler.symbolTable.Define(stmt.Name.Value)
+		case *ast.BlockStatement:
+			compiler.hoist(stmt.Statements)
+		}
+	}
+}
+
+// enterBlock gives the names bound until the returned function is called a block symbol table of their own. The
+// returned function leaves the block and frees the slots its names took for the names bound after it, unless they are
+// globals, which a function defined in the block keeps referring to once the block ends.
+func (compiler *Compiler) enterBlock() func() {
+	activeScope := compiler.scopes[compiler.activeScopeIdx]
+	enclosingBound := activeScope.bound
+	activeScope.bound = map[string]bool{}
+	compiler.symbolTable = NewBlockSymbolTable(compiler.symbolTable)
+	owner, size, functions := compiler.symbolTable.owner(), compiler.symbolTable.owner().size, compiler.functions
+	return func() {
+		compiler.symbolTable = compiler.symbolTable.outer
+		activeScope.bound = enclosingBound
+		if owner.outer != nil || compiler.functions == functions {
+			owner.size = size
+		}
+	}
+}
+
+// compileMethodCall compiles receiver.name(args) for a name that is a builtin. The function bound to name is pushed
+// below the receiver and the arguments, and OpCallMethod calls it with the receiver as its first argument, unless the
+// receiver is a hash holding name, whose member it calls instead.
+func (compiler *Compiler) compileMethodCall(n *ast.CallExpression, receiver ast.Expression, name string) error {
+	symbol, _ := compiler.symbolTable.Lookup(name)
+	compiler.loadSymbol(symbol)
+	err := compiler.Compile(receiver)
+	if err != nil {
+		return err
+	}
+	for _, arg := range n.Arguments {
+		err := compiler.Compile(arg)
+		if err != nil {
+			return err
+		}
+	}
+	compiler.emit(bytecode.OpCallMethod, compiler.addConstant(&object.String{Value: name}), len(n.Arguments))
+	return nil
+}
+
+// compileMatchExpression stores the subject in a hidden symbol, in a block ending with the match, and tests it against
+// each arm in turn. OpMatch pushes the values bound by a matching pattern followed by true, or just false. As in the
+// evaluator, each arm gets its own block symbol table, so the bound names shadow the enclosing ones only within the arm.
+func (compiler *Compiler) compileMatchExpression(n *ast.MatchExpression, asValue bool) error {
+	activeScope := compiler.scopes[compiler.activeScopeIdx]
+	err := compiler.Compile(n.Subject)
+	if err != nil {
+		return err
+	}
+	defer compiler.enterBlock()()
+	// the space keeps the name from clashing with any identifier
+	subject := compiler.symbolTable.Define(fmt.Sprintf("match subject %d", len(activeScope.instructions)))
+	compiler.storeSymbol(subject)
+
+	var endJumpOffsets []int
+	for _, arm := range n.Arms {
+		compiler.loadSymbol(subject)
+		pattern := &object.Pattern{Node: arm.Pattern, Names: object.PatternNames(arm.Pattern)}
+		compiler.emit(bytecode.OpMatch, compiler.addConstant(pattern))
+		compiler.emit(bytecode.OpJumpIfFalse, 9999)
+		conditionalJumpOffset := activeScope.lastAddedInsOffset
+
+		err = compiler.compileMatchArm(arm, pattern.Names, asValue)
+		if err != nil {
+			return err
+		}
+		compiler.emit(bytecode.OpJump, 9999)
+		endJumpOffsets = append(endJumpOffsets, activeScope.lastAddedInsOffset)
+
+		// Back-patch conditional jump to the next arm
+		newConditionalJumpIns, _ := bytecode.Make(bytecode.OpJumpIfFalse, len(activeScope.instructions))
+		compiler.modifyInstruction(conditionalJumpOffset, newConditionalJumpIns)
+	}
+	compiler.emit(bytecode.OpError, compiler.addConstant(&object.String{Value: "no pattern matched the value"}))
+
+	for _, offset := range endJumpOffsets {
+		newJumpIns, _ := bytecode.Make(bytecode.OpJump, len(activeScope.instructions))
+		compiler.modifyInstruction(offset, newJumpIns)
+	}
+	return nil
+}
+
+// checkCall reports a top level statement calling, or binding the result of calling, a global that the statements
+// before it bound to a non-function literal. This is a best effort check for the obvious case, any other call of a value
+// that is not a function still fails at runtime.
+func (compiler *Compiler) checkCall(stmt ast.Statement) error {
+	var expr ast.Expression
+	switch stmt := stmt.(type) {
+	case *ast.ExpressionStatement:
+		expr = stmt.Expr
+	case *ast.LetStatement:
+		expr = stmt.Right
+	}
+	call, ok := expr.(*ast.CallExpression)
+	if !ok {
+		return nil
+	}
+	name, ok := call.Function.(*ast.Identifier)
+	if !ok {
+		return nil
+	}
+	symbol, ok := compiler.symbolTable.Lookup(name.Value)
+	if !ok || symbol.Scope != GLOBAL {
+		return nil
+	}
+	if literalType, ok := compiler.literalGlobals[symbol.Index]; ok {
+		return newError(call.Token, "%s is not a function, it is bound to %s", name.Value, literalType)
+	}
+	return nil
+}
+
+// recordLiteralGlobal remembers the type of the literal a top level let binds a global to, if it is not a function.
+func (compiler *Compiler) recordLiteralGlobal(stmt ast.Statement) {
+	let, ok := stmt.(*ast.LetStatement)
+	if !ok {
+		return
+	}
+	symbol, ok := compiler.symbolTable.Lookup(let.Name.Value)
+	if !ok || symbol.Scope != GLOBAL {
+		return
+	}
+	switch let.Right.(type) {
+	case *ast.IntegerLiteral:
+		compiler.literalGlobals[symbol.Index] = object.IntegerObject
+	case *ast.StringLiteral:
+		compiler.literalGlobals[symbol.Index] = object.StringObject
+	case *ast.BooleanLiteral:
+		compiler.literalGlobals[symbol.Index] = object.BooleanObject
+	case *ast.ArrayLiteral:
+		compiler.literalGlobals[symbol.Index] = object.ArrayObject
+	case *ast.HashLiteral:
+		compiler.literalGlobals[symbol.Index] = object.HashObject
+	}
+}
+
+// compileMatchArm stores the values bound by the pattern of arm, pushed by OpMatch in the order of names, and compiles
+// its body, whose value is used when asValue is set, both in a block symbol table of their own.
+func (compiler *Compiler) compileMatchArm(arm *ast.MatchArm, names []string, asValue bool) error {
+	defer compiler.enterBlock()()
+
+	for i := len(names) - 1; i >= 0; i-- {
+		compiler.storeSymbol(compiler.symbolTable.Define(names[i]))
+	}
+	return compiler.compileExpression(arm.Body, asValue)
+}
+
 // addConstant adds the constant to the constant pool and returns the index where it is stored
 func (compiler *Compiler) addConstant(obj object.Object) int {
 	compiler.constantPool = append(compiler.constantPool, obj)
@@ -361,6 +719,9 @@ func (compiler *Compiler) addInstruction(ins []byte) {
 	insertPos := len(activeScope.instructions)
 	activeScope.instructions = append(activeScope.instructions, ins...)
 	activeScope.lastAddedInsOffset = insertPos
+	if compiler.position.Line != 0 {
+		activeScope.sourceMap[insertPos] = compiler.position
+	}
 }
 
 func (compiler *Compiler) modifyInstruction(offset int, newInstruction []byte) {
@@ -372,6 +733,7 @@ func (compiler *Compiler) Output() ByteCode {
 	return ByteCode{
 		Instructions: compiler.scopes[compiler.activeScopeIdx].instructions,
 		ConstantPool: compiler.constantPool,
+		SourceMap:    compiler.scopes[compiler.activeScopeIdx].sourceMap,
 	}
 }
 
@@ -384,6 +746,23 @@ func (compiler *Compiler) emit(op bytecode.OpCode, operands ...int) error {
 	return nil
 }
 
+// Warnings returns the warnings collected so far, if enabled with WithWarnings.
+func (compiler *Compiler) Warnings() []*Warning {
+	return compiler.warnings
+}
+
+// bind records name as bound in the active scope, warning when it already was and warnings are enabled.
+func (compiler *Compiler) bind(name *ast.Identifier) {
+	scope := compiler.scopes[compiler.activeScopeIdx]
+	if compiler.warn && scope.bound[name.Value] {
+		compiler.warnings = append(compiler.warnings, &Warning{
+			Token:   name.Token,
+			Message: fmt.Sprintf("%s is already defined in this scope", name.Value),
+		})
+	}
+	scope.bound[name.Value] = true
+}
+
 func (compiler *Compiler) enterScope() {
 	scope := NewCompilationScope()
 	compiler.scopes = append(compiler.scopes, scope)
@@ -398,7 +777,11 @@ func (compiler *Compiler) exitScope() {
 func (compiler *Compiler) loadSymbol(symbol Symbol) {
 	switch symbol.Scope {
 	case GLOBAL:
-		compiler.emit(bytecode.OpGetGlobal, symbol.Index)
+		if builtin, ok := builtInSymbols[symbol.Name]; ok {
+			compiler.emit(bytecode.OpGetGlobalOrBuiltIn, symbol.Index, builtin.Index)
+		} else {
+			compiler.emit(bytecode.OpGetGlobal, symbol.Index)
+		}
 	case LOCAL:
 		compiler.emit(bytecode.OpGetLocal, symbol.Index)
 	case BUILTIN:
@@ -2,6 +2,7 @@ package compiler
 
 import (
 	"bytes"
+	"fmt"
 	"github.com/jatin-malik/yal/bytecode"
 	"github.com/jatin-malik/yal/lexer"
 	"github.com/jatin-malik/yal/object"
@@ -84,6 +85,8 @@ func TestCompile(t *testing.T) {
 				0x00,       // OpPush (3)
 				0x00, 0x02, // Index 2 (constant pool: 3)
 
+				0x1E, // OpPop discards the value of the if, only the last statement is the value of the program
+
 				// OpPush (1) to check the condition
 				0x00,       // OpPush (1)
 				0x00, 0x03, // Index 3 (constant pool: 4)
@@ -108,6 +111,8 @@ func TestCompile(t *testing.T) {
 
 				0x0E,
 
+				0x1E, // OpPop
+
 				// OpPush (1) to check the condition
 				0x00,       // OpPush (1)
 				0x00, 0x02, // Index 2 (constant pool: 3)
@@ -130,6 +135,8 @@ func TestCompile(t *testing.T) {
 
 				0x0E,
 
+				0x1E, // OpPop
+
 				// OpPush (1) to check the condition
 				0x00,       // OpPush (1)
 				0x00, 0x01, // Index 1 (constant pool: 2)
@@ -150,6 +157,158 @@ func TestCompile(t *testing.T) {
 	}
 }
 
+func TestReset(t *testing.T) {
+	compiler := New()
+	var outputs []ByteCode
+	for _, input := range []string{`let x = 1; x + 2`, `let y = 3; y`} {
+		compiler.Reset()
+		program := parser.New(lexer.New(input)).ParseProgram()
+		if err := compiler.Compile(program); err != nil {
+			t.Fatalf("Compilation failed: %v", err)
+		}
+		outputs = append(outputs, compiler.Output())
+	}
+
+	for i, input := range []string{`let x = 1; x + 2`, `let y = 3; y`} {
+		fresh, err := testCompile(input)
+		if err != nil {
+			t.Fatalf("Compilation failed: %v", err)
+		}
+		expected := fresh.Output()
+		assertBytecode(t, expected.Instructions, outputs[i].Instructions)
+		if len(outputs[i].ConstantPool) != len(expected.ConstantPool) {
+			t.Errorf("Constant pool length mismatch: expected %d, got %d", len(expected.ConstantPool), len(outputs[i].ConstantPool))
+		}
+	}
+
+	// symbols do not survive a reset
+	compiler.Reset()
+	program := parser.New(lexer.New(`y`)).ParseProgram()
+	if err := compiler.Compile(program); err == nil {
+		t.Errorf("expected y to be undefined after reset")
+	}
+
+	// options are applied again
+	symbolTable := NewSymbolTable(nil)
+	symbolTable.Define("z")
+	compiler.Reset(WithSymbolTable(symbolTable))
+	program = parser.New(lexer.New(`z`)).ParseProgram()
+	if err := compiler.Compile(program); err != nil {
+		t.Errorf("expected z to be defined by the symbol table option: %v", err)
+	}
+}
+
+func TestRebindingWarnings(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string // warnings as line:column message
+	}{
+		{`let x = 1; let x = 2;`, []string{"1:16 x is already defined in this scope"}},
+		{"let x = 1;\nlet y = 2;\nlet x = 3;", []string{"3:5 x is already defined in this scope"}},
+		{`let f = fn(a) { let a = 2; a };`, []string{"1:21 a is already defined in this scope"}},
+		{`let f = fn() { let n = 1; let n = 2; n };`, []string{"1:31 n is already defined in this scope"}},
+		{`let x = 1; let x = 2; let x = 3;`, []string{
+			"1:16 x is already defined in this scope",
+			"1:27 x is already defined in this scope",
+		}},
+
+		// a let in a function shadows the name of the enclosing scope rather than rebinding it
+		{`let x = 1; let f = fn() { let x = 2; x };`, nil},
+		{`let f = fn(a) { fn(b) { let a = b; a } };`, nil},
+		{`let x = 1; let y = x;`, nil},
+		{`let len = fn(a) { 0 };`, nil},
+		{`let x = 1; let y = do { let x = 2; x };`, nil},
+		{`let y = do { let x = 1; let x = 2; x };`, []string{"1:29 x is already defined in this scope"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			program := parser.New(lexer.New(tt.input)).ParseProgram()
+			compiler := New(WithWarnings())
+			if err := compiler.Compile(program); err != nil {
+				t.Fatalf("Compilation failed: %v", err)
+			}
+
+			var warnings []string
+			for _, warning := range compiler.Warnings() {
+				warnings = append(warnings, fmt.Sprintf("%d:%d %s", warning.Token.Line, warning.Token.Column, warning.Message))
+			}
+			if fmt.Sprint(warnings) != fmt.Sprint(tt.expected) {
+				t.Errorf("expected warnings %v, got %v", tt.expected, warnings)
+			}
+		})
+	}
+
+	// warnings are off by default
+	compiler, err := testCompile(`let x = 1; let x = 2;`)
+	if err != nil {
+		t.Fatalf("Compilation failed: %v", err)
+	}
+	if len(compiler.Warnings()) != 0 {
+		t.Errorf("expected no warnings without WithWarnings, got %d", len(compiler.Warnings()))
+	}
+}
+
+func TestLateGlobals(t *testing.T) {
+	symTable := NewSymbolTable(nil)
+	program := parser.New(lexer.New(`let f = fn() { g() };`)).ParseProgram()
+	if err := New(WithSymbolTable(symTable), WithLateGlobals()).Compile(program); err != nil {
+		t.Fatalf("Compilation failed: %v", err)
+	}
+	if symbol, ok := symTable.Lookup("g"); !ok || symbol.Scope != GLOBAL {
+		t.Errorf("expected g to be defined as a global, got %+v", symbol)
+	}
+
+	// only names in functions are late, and only with the option
+	program = parser.New(lexer.New(`h`)).ParseProgram()
+	if err := New(WithLateGlobals()).Compile(program); err == nil || err.Error() != "unknown identifier h" {
+		t.Errorf("expected unknown identifier h at the top level, got %v", err)
+	}
+	if _, err := testCompile(`let f = fn() { g() };`); err == nil || err.Error() != "unknown identifier g" {
+		t.Errorf("expected unknown identifier g without WithLateGlobals, got %v", err)
+	}
+}
+
+func TestCallingNonFunction(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string // error as line:column message, empty if the call is left to fail at runtime
+	}{
+		{`let x = 5; x(1)`, "1:13 x is not a function, it is bound to INTEGER"},
+		{"let s = \"yal\";\nlet r = s();", "2:10 s is not a function, it is bound to STRING"},
+		{`let h = {"f": fn() { 1 }}; h()`, "1:29 h is not a function, it is bound to HASH"},
+		{`let a = [1]; let b = true; b(a)`, "1:29 b is not a function, it is bound to BOOLEAN"},
+
+		{`let x = 5; let x = fn(a) { a }; x(1)`, ""},
+		{`let x = fn(a) { a }; if (false) { let x = 5; } x(1)`, ""},
+		{`let x = fn(a) { a }; loop (false) { let x = 5; } x(1)`, ""},
+		{`let x = 5; let f = fn() { x(1) };`, ""},
+		{`let x = 5; do { let x = fn(a) { a }; x(1) }`, ""},
+		{`let x = 5; let y = x; y(1)`, ""},
+		{`let x = 5; puts(x(1))`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := testCompile(tt.input)
+			if tt.expected == "" {
+				if err != nil {
+					t.Errorf("expected no compile error, got %v", err)
+				}
+				return
+			}
+			compileErr, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("expected *Error, got %T: %v", err, err)
+			}
+			got := fmt.Sprintf("%d:%d %s", compileErr.Token.Line, compileErr.Token.Column, compileErr.Message)
+			if got != tt.expected {
+				t.Errorf("expected error %q, got %q", tt.expected, got)
+			}
+		})
+	}
+}
+
 func testCompile(input string) (*Compiler, error) {
 	lexer := lexer.New(input)
 	parser := parser.New(lexer)
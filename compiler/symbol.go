@@ -20,6 +20,9 @@ type SymbolTable struct {
 	store       map[string]Symbol
 	outer       *SymbolTable
 	freeSymbols []Symbol
+	size        int  // number of slots taken, shadowed symbols included, until a block ending frees its own
+	peak        int  // most slots taken at once, the number the frame or the globals need
+	block       bool // the table of a do block, whose symbols take their slots from the enclosing table
 }
 
 var builtInSymbols = map[string]Symbol{
@@ -53,37 +56,170 @@ var builtInSymbols = map[string]Symbol{
 		Index: 5,
 		Scope: BUILTIN,
 	},
+	"print": {
+		Name:  "print",
+		Index: 6,
+		Scope: BUILTIN,
+	},
+	"match": {
+		Name:  "match",
+		Index: 7,
+		Scope: BUILTIN,
+	},
+	"find_all": {
+		Name:  "find_all",
+		Index: 8,
+		Scope: BUILTIN,
+	},
+	"getenv": {
+		Name:  "getenv",
+		Index: 9,
+		Scope: BUILTIN,
+	},
+	"setenv": {
+		Name:  "setenv",
+		Index: 10,
+		Scope: BUILTIN,
+	},
+	"args": {
+		Name:  "args",
+		Index: 11,
+		Scope: BUILTIN,
+	},
+	"clone": {
+		Name:  "clone",
+		Index: 12,
+		Scope: BUILTIN,
+	},
+	"freeze": {
+		Name:  "freeze",
+		Index: 13,
+		Scope: BUILTIN,
+	},
+	"arity": {
+		Name:  "arity",
+		Index: 14,
+		Scope: BUILTIN,
+	},
+	"partial": {
+		Name:  "partial",
+		Index: 15,
+		Scope: BUILTIN,
+	},
+	"compose": {
+		Name:  "compose",
+		Index: 16,
+		Scope: BUILTIN,
+	},
+	"pipe": {
+		Name:  "pipe",
+		Index: 17,
+		Scope: BUILTIN,
+	},
+	"deepequal": {
+		Name:  "deepequal",
+		Index: 18,
+		Scope: BUILTIN,
+	},
+	"rjust": {
+		Name:  "rjust",
+		Index: 19,
+		Scope: BUILTIN,
+	},
+	"ljust": {
+		Name:  "ljust",
+		Index: 20,
+		Scope: BUILTIN,
+	},
+	"flush": {
+		Name:  "flush",
+		Index: 21,
+		Scope: BUILTIN,
+	},
+	"sleep": {
+		Name:  "sleep",
+		Index: 22,
+		Scope: BUILTIN,
+	},
 }
 
 func NewSymbolTable(outer *SymbolTable) *SymbolTable {
 	return &SymbolTable{store: make(map[string]Symbol), outer: outer}
 }
 
+// NewBlockSymbolTable returns the table for the names bound in a do block inside the scope of outer. They shadow the
+// names of outer but live in the same frame, or among the globals at the top level, so their indices come from the
+// function or program table outer belongs to.
+func NewBlockSymbolTable(outer *SymbolTable) *SymbolTable {
+	return &SymbolTable{store: make(map[string]Symbol), outer: outer, block: true}
+}
+
+// owner returns the table of the function or program whose slots the symbols of table take.
+func (table *SymbolTable) owner() *SymbolTable {
+	owner := table
+	for owner.block {
+		owner = owner.outer
+	}
+	return owner
+}
+
+// global returns the table of the program, whose symbols are globals.
+func (table *SymbolTable) global() *SymbolTable {
+	global := table
+	for global.outer != nil {
+		global = global.outer
+	}
+	return global
+}
+
+// Clone returns a copy of table whose definitions do not change table, so a failed compilation can be discarded.
+func (table *SymbolTable) Clone() *SymbolTable {
+	clone := *table
+	clone.store = make(map[string]Symbol, len(table.store))
+	for name, symbol := range table.store {
+		clone.store[name] = symbol
+	}
+	clone.freeSymbols = append([]Symbol(nil), table.freeSymbols...)
+	return &clone
+}
+
+// Define returns the symbol for a let of identifier. A let of a name already defined in this table reuses its symbol,
+// while a let of a captured free variable or of the function's own name shadows it with a new local.
 func (table *SymbolTable) Define(identifier string) Symbol {
-	if symbol, exists := table.store[identifier]; exists {
+	if symbol, exists := table.store[identifier]; exists && (symbol.Scope == GLOBAL || symbol.Scope == LOCAL) {
 		return symbol
 	}
-	symbol := Symbol{Name: identifier, Index: len(table.store)}
-	if table.outer == nil {
+	owner := table.owner()
+	symbol := Symbol{Name: identifier, Index: owner.size}
+	if owner.outer == nil {
 		symbol.Scope = GLOBAL
 	} else {
 		symbol.Scope = LOCAL
 	}
 
 	table.store[identifier] = symbol
+	owner.take()
 	return symbol
 }
 
 func (table *SymbolTable) DefineFunctionSymbol(name string) Symbol {
-	symbol := Symbol{Name: name, Index: len(table.store), Scope: FUNCTION}
+	symbol := Symbol{Name: name, Index: table.size, Scope: FUNCTION}
 	table.store[name] = symbol
+	table.take()
 	return symbol
 }
 
+// take takes the next slot of table.
+func (table *SymbolTable) take() {
+	table.size++
+	table.peak = max(table.peak, table.size)
+}
+
 func (table *SymbolTable) defineFree(symbol Symbol) Symbol {
 	table.freeSymbols = append(table.freeSymbols, symbol)
 	freeSymbol := Symbol{Name: symbol.Name, Index: len(table.freeSymbols) - 1, Scope: FREE}
 	table.store[freeSymbol.Name] = freeSymbol
+	table.take()
 	return freeSymbol
 }
 
@@ -91,6 +227,10 @@ func (table *SymbolTable) Lookup(identifier string) (Symbol, bool) {
 	if symbol, ok := table.store[identifier]; ok {
 		return symbol, true
 	}
+	if table.block {
+		// the enclosing names are in the same frame, not free
+		return table.outer.Lookup(identifier)
+	}
 	if table.outer != nil {
 		symbol, ok := table.outer.Lookup(identifier)
 		if symbol.Scope == LOCAL || symbol.Scope == FREE {
@@ -107,6 +247,20 @@ func (table *SymbolTable) Lookup(identifier string) (Symbol, bool) {
 	return Symbol{}, false
 }
 
+// names returns every identifier visible from this table, including builtins.
+func (table *SymbolTable) names() []string {
+	var names []string
+	for t := table; t != nil; t = t.outer {
+		for name := range t.store {
+			names = append(names, name)
+		}
+	}
+	for name := range builtInSymbols {
+		names = append(names, name)
+	}
+	return names
+}
+
 func (table *SymbolTable) len() int {
-	return len(table.store)
+	return table.peak
 }
@@ -8,26 +8,29 @@ import (
 	"github.com/jatin-malik/yal/token"
 )
 
+// Strict makes an if without else whose value is used fail when its condition is false, and indexing a hash with a
+// missing key fail, instead of both producing null.
+var Strict bool
+
+// Eval evaluates node in env. An error it fails with is located at the innermost node with a source position on the
+// way to it, the node the compiler maps the failing instruction of the VM to.
 func Eval(node ast.Node, env *object.Environment) object.Object {
+	result := eval(node, env)
+	if err, ok := result.(*object.Error); ok && err.Token.Line == 0 {
+		if tok, ok := ast.NodeToken(node); ok {
+			err.Token = tok
+		}
+	}
+	return result
+}
+
+func eval(node ast.Node, env *object.Environment) object.Object {
 	var result object.Object
 	switch v := node.(type) {
 	case *ast.Program:
-		for _, stmt := range v.Statements {
-			result = Eval(stmt, env)
-			if object.IsReturnValue(result) {
-				return result.(*object.ReturnValue).Value // unwrap
-			}
-			if object.IsErrorValue(result) {
-				return result // no unwrap
-			}
-		}
+		return evalProgram(v, env)
 	case *ast.BlockStatement:
-		for _, stmt := range v.Statements {
-			result = Eval(stmt, env)
-			if object.IsReturnValue(result) || object.IsErrorValue(result) {
-				return result
-			}
-		}
+		return evalBlock(v, env, false)
 	case *ast.ReturnStatement:
 		obj := Eval(v.Value, env)
 		if object.IsErrorValue(obj) {
@@ -35,7 +38,7 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		result = &object.ReturnValue{Value: obj}
 	case *ast.ExpressionStatement:
-		result = Eval(v.Expr, env)
+		result = evalExpression(v.Expr, env, false)
 	case *ast.IntegerLiteral:
 		result = &object.Integer{Value: v.Value}
 	case *ast.StringLiteral:
@@ -53,18 +56,18 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		result = &object.Array{Elements: elems}
 	case *ast.HashLiteral:
-		pairs := make(map[object.Object]object.Object)
+		pairs := make([]object.Object, 0, 2*len(v.Pairs))
 
-		for k, v := range v.Pairs {
-			key := Eval(k, env)
+		for _, pair := range v.Pairs {
+			key := Eval(pair.Key, env)
 			if object.IsErrorValue(key) {
 				return key
 			}
-			val := Eval(v, env)
+			val := Eval(pair.Value, env)
 			if object.IsErrorValue(val) {
 				return val
 			}
-			pairs[key] = val
+			pairs = append(pairs, key, val)
 		}
 
 		result = evalHashLiteral(pairs)
@@ -84,12 +87,17 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 			return quote(v.Arguments[0], env)
 		}
 
-		fn := Eval(v.Function, env)
+		var fn object.Object
+		var args []object.Object
+		if receiver, name, ok := v.Method(); ok {
+			fn, args = evalMethod(receiver, name, env)
+		} else {
+			fn = Eval(v.Function, env)
+		}
 		if object.IsErrorValue(fn) {
 			return fn
 		}
 
-		var args []object.Object
 		if _, ok := fn.(*object.Macro); ok {
 			for _, arg := range v.Arguments {
 				args = append(args, &object.Quote{Node: arg})
@@ -135,28 +143,24 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 		result = evalInfixExpression(v.Operator, leftObj, rightObj)
 	case *ast.IfElseConditional:
-		conditionObj := Eval(v.Condition, env)
-		if object.IsErrorValue(conditionObj) {
-			return conditionObj
-		}
-		if object.IsTruthy(conditionObj) {
-			result = Eval(v.Consequence, env)
-		} else {
-			if v.Alternative != nil {
-				result = Eval(v.Alternative, env)
-			} else {
-				result = object.NULL
-			}
-		}
+		result = evalIfElseConditional(v, env, true)
+	case *ast.DoExpression:
+		result = evalDoExpression(v, env, true)
+	case *ast.MatchExpression:
+		result = evalMatchExpression(v, env, true)
 	case *ast.LoopStatement:
 		for {
+			if object.IsInterrupted() {
+				return object.NewError("interrupted")
+			}
 			result = Eval(v.Condition, env)
 			if object.IsErrorValue(result) {
 				return result
 			}
 			if object.IsTruthy(result) {
 				result = Eval(v.Body, env)
-				if object.IsErrorValue(result) {
+				// a return leaves the enclosing function, not just the loop
+				if object.IsReturnValue(result) || object.IsErrorValue(result) {
 					return result
 				}
 			} else {
@@ -165,12 +169,18 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 		}
 	case *ast.LetStatement:
 		rightObj := Eval(v.Right, env)
-		if object.IsErrorValue(rightObj) {
-			return rightObj
+		if object.IsErrorValue(rightObj) || object.IsReturnValue(rightObj) {
+			return rightObj // a return in a do or if block on the right returns from the function
 		}
 		env.Set(v.Name.Value, rightObj)
 	case *ast.Identifier:
 		result = env.Get(v.Value)
+	case *ast.ImportStatement:
+		msg := fmt.Sprintf("unresolved import %s", v.Path)
+		result = object.NewError(msg)
+	case *ast.ImportExpression:
+		msg := fmt.Sprintf("unresolved import %s", v.Path)
+		result = object.NewError(msg)
 	default:
 		msg := fmt.Sprintf("Unknown statement type: %T", v)
 		result = object.NewError(msg)
@@ -179,6 +189,122 @@ func Eval(node ast.Node, env *object.Environment) object.Object {
 	return result
 }
 
+// evalMethod resolves the function called by receiver.name(args) and the arguments to call it with before args. A hash
+// holding name calls that member. Otherwise, when name is a builtin, the function bound to name is called with the
+// receiver as its first argument. Any other call goes to the member, as receiver.name gives it.
+func evalMethod(receiver ast.Expression, name string, env *object.Environment) (object.Object, []object.Object) {
+	obj := Eval(receiver, env)
+	if object.IsErrorValue(obj) {
+		return obj, nil
+	}
+	key := &object.String{Value: name}
+	if hash, ok := obj.(*object.Hash); ok {
+		if member, ok := hash.Get(key); ok {
+			return member, nil
+		}
+	}
+	if _, ok := object.BuiltinFunctions[name]; ok {
+		return env.Get(name), []object.Object{obj}
+	}
+	return evalIndexExpression(obj, key), nil
+}
+
+// evalProgram evaluates the statements of program and returns the value of the last one, nil if the program has none.
+// Buffered output is flushed first, so a host printing the result prints it after the output of the program. A flush
+// that fails turns a successful program into an error.
+func evalProgram(program *ast.Program, env *object.Environment) object.Object {
+	var result object.Object
+	for _, stmt := range program.Statements {
+		result = Eval(stmt, env)
+		if object.IsReturnValue(result) || object.IsErrorValue(result) {
+			break
+		}
+	}
+	if err := object.FlushOutput(); err != nil && !object.IsErrorValue(result) {
+		return object.NewError(err.Error())
+	}
+
+	switch {
+	case object.IsReturnValue(result):
+		return result.(*object.ReturnValue).Value // unwrap
+	case object.IsErrorValue(result):
+		return result // no unwrap
+	case !program.HasValue():
+		return nil
+	}
+	return result
+}
+
+// evalIfElseConditional evaluates an if expression. A missing else produces null, or in strict mode an error when
+// asValue reports that the result is used.
+func evalIfElseConditional(ifElse *ast.IfElseConditional, env *object.Environment, asValue bool) object.Object {
+	conditionObj := Eval(ifElse.Condition, env)
+	if object.IsErrorValue(conditionObj) {
+		return conditionObj
+	}
+	if object.IsTruthy(conditionObj) {
+		return evalBlock(ifElse.Consequence, env, asValue)
+	}
+	if ifElse.Alternative != nil {
+		return evalBlock(ifElse.Alternative, env, asValue)
+	}
+	if Strict && asValue {
+		return object.NewError("if without else has no value: condition is false")
+	}
+	return object.NULL
+}
+
+// evalExpression evaluates expr, whose value is used when asValue is set. That matters for an if without else, which
+// fails in strict mode when used, and for the expressions whose value is that of an if, a do block or a match arm.
+func evalExpression(expr ast.Expression, env *object.Environment, asValue bool) object.Object {
+	switch expr := expr.(type) {
+	case *ast.IfElseConditional:
+		return evalIfElseConditional(expr, env, asValue)
+	case *ast.DoExpression:
+		return evalDoExpression(expr, env, asValue)
+	case *ast.MatchExpression:
+		return evalMatchExpression(expr, env, asValue)
+	}
+	return Eval(expr, env)
+}
+
+// evalBlock evaluates the statements of block up to a return or an error, the value of the last one used when asValue
+// is set.
+func evalBlock(block *ast.BlockStatement, env *object.Environment, asValue bool) object.Object {
+	var result object.Object
+	for i, stmt := range block.Statements {
+		if exprStmt, ok := stmt.(*ast.ExpressionStatement); ok && asValue && i == len(block.Statements)-1 {
+			result = evalExpression(exprStmt.Expr, env, true)
+		} else {
+			result = Eval(stmt, env)
+		}
+		if object.IsReturnValue(result) || object.IsErrorValue(result) {
+			return result
+		}
+	}
+	return result
+}
+
+// evalMatchExpression evaluates the body of the first arm matching the subject, with the names bound by its pattern in
+// an enclosed scope. The value of the body is used when asValue is set.
+func evalMatchExpression(me *ast.MatchExpression, env *object.Environment, asValue bool) object.Object {
+	subject := Eval(me.Subject, env)
+	if object.IsErrorValue(subject) {
+		return subject
+	}
+	for _, arm := range me.Arms {
+		bindings := make(map[string]object.Object)
+		if object.MatchPattern(arm.Pattern, subject, bindings) {
+			armEnv := object.NewEnvironment(env)
+			for name, value := range bindings {
+				armEnv.Set(name, value)
+			}
+			return evalExpression(arm.Body, armEnv, asValue)
+		}
+	}
+	return object.NewError("no pattern matched the value")
+}
+
 func getBooleanObject(boolValue bool) object.Object {
 	if boolValue {
 		return object.TRUE
@@ -199,6 +325,17 @@ func evalPrefixExpression(operator string, right object.Object) object.Object {
 }
 
 func evalInfixExpression(operator string, left, right object.Object) object.Object {
+	// string * int repeats the string, the only operation mixing types
+	if str, ok := left.(*object.String); ok && operator == "*" {
+		if count, ok := right.(*object.Integer); ok {
+			repeated, err := str.Repeat(count.Value)
+			if err != nil {
+				return object.NewError(err.Error())
+			}
+			return repeated
+		}
+	}
+
 	// check for type mismatch
 	if left.Type() != right.Type() {
 		errorMsg := fmt.Sprintf("Incompatible types: %s and %s", left.Type(), right.Type())
@@ -287,6 +424,8 @@ func evalEqualsInfixExpression(left, right object.Object) object.Object {
 		return getBooleanObject(left.(*object.String).Value == right.(*object.String).Value)
 	case object.BooleanObject:
 		return getBooleanObject(left == right) // no need to unwrap
+	case object.ArrayObject, object.HashObject:
+		return getBooleanObject(object.DeepEqual(left, right))
 	default:
 		return object.NULL
 	}
@@ -340,6 +479,9 @@ func evalBangPrefixExpression(right object.Object) object.Object {
 func evalCallExpression(function object.Object, args []object.Object) object.Object {
 	switch function.Type() {
 	case object.FunctionObject:
+		if object.IsInterrupted() {
+			return object.NewError("interrupted")
+		}
 		fn := function.(*object.Function)
 		// Extend the environment for this function evaluation
 		extendedEnv := object.NewEnvironment(fn.Env)
@@ -353,7 +495,8 @@ func evalCallExpression(function object.Object, args []object.Object) object.Obj
 			extendedEnv.Set(param.Value, args[idx])
 		}
 
-		result := Eval(fn.Body, extendedEnv)
+		// the last statement of the body is the value the function returns
+		result := evalBlock(fn.Body, extendedEnv, true)
 		if object.IsReturnValue(result) {
 			return result.(*object.ReturnValue).Value // unwrap
 		}
@@ -381,6 +524,22 @@ func evalCallExpression(function object.Object, args []object.Object) object.Obj
 	case object.BuiltInFunctionObject:
 		fn := function.(*object.BuiltinFunction)
 		return fn.Fn(args...)
+	case object.PartialObject:
+		partial := function.(*object.Partial)
+		allArgs := make([]object.Object, 0, len(partial.Args)+len(args))
+		allArgs = append(append(allArgs, partial.Args...), args...)
+		return evalCallExpression(partial.Fn, allArgs)
+	case object.PipelineObject:
+		pipeline := function.(*object.Pipeline)
+		var result object.Object
+		for _, fn := range pipeline.Fns {
+			result = evalCallExpression(fn, args)
+			if object.IsErrorValue(result) {
+				return result
+			}
+			args = []object.Object{result}
+		}
+		return result
 	default:
 		msg := fmt.Sprintf("expected *object.Function, got %s", function.Type())
 		return object.NewError(msg)
@@ -393,6 +552,8 @@ func evalIndexExpression(iterable object.Object, index object.Object) object.Obj
 		return evalArrayIndexExpression(iterable, index)
 	case object.HashObject:
 		return evalHashIndexExpression(iterable, index)
+	case object.StringObject:
+		return evalStringIndexExpression(iterable, index)
 	default:
 		msg := fmt.Sprintf("index expression not supported for type: %s", iterable.Type())
 		return object.NewError(msg)
@@ -406,45 +567,71 @@ func evalArrayIndexExpression(iterable object.Object, index object.Object) objec
 	if i, ok := index.(*object.Integer); !ok {
 		return object.NewError("index must be an integer for index expression in arrays")
 	} else {
-		// Check bounds of the index
-		idx := i.Value
-		if idx < 0 || idx >= int64(len(arr.Elements)) {
-			return object.NewError(fmt.Sprintf("index out of bounds for arr length %d", len(arr.Elements)))
+		elem, err := arr.Get(i.Value)
+		if err != nil {
+			return object.NewError(err.Error())
 		}
-
-		return arr.Elements[idx]
+		return elem
 	}
 
 }
 
+func evalStringIndexExpression(iterable object.Object, index object.Object) object.Object {
+	str := iterable.(*object.String)
+
+	// The index has to be an integer
+	if i, ok := index.(*object.Integer); !ok {
+		return object.NewError("index must be an integer for index expression in strings")
+	} else {
+		char, err := str.Get(i.Value)
+		if err != nil {
+			return object.NewError(err.Error())
+		}
+		return char
+	}
+}
+
 func evalHashIndexExpression(iterable object.Object, index object.Object) object.Object {
 	hash := iterable.(*object.Hash)
-	// Check if key is hashable
-	if key, ok := index.(object.Hashable); !ok {
-		return object.NewError(fmt.Sprintf("key type %s is not hashable", index.Type()))
-	} else {
-		hashKey := key.HashKey()
-		if val, ok := hash.Pairs[hashKey]; ok {
-			return val
-		} else {
-			return object.NULL
+	if err := object.CheckKey(index); err != nil {
+		return object.NewError(err.Error())
+	}
+	val, ok := hash.Get(index)
+	if !ok {
+		if Strict {
+			return object.NewError(fmt.Sprintf("key %s not found in hash", object.KeyString(index)))
 		}
+		return object.NULL
 	}
+	return val
 }
 
-func evalHashLiteral(pairs map[object.Object]object.Object) object.Object {
-	ho := new(object.Hash)
-	elems := make(map[object.HashKey]object.Object)
-	for k, v := range pairs {
-		// Check if key is hashable
-		if key, ok := k.(object.Hashable); !ok {
-			return object.NewError(fmt.Sprintf("key type %s is not hashable", k.Type()))
-		} else {
-			hashKey := key.HashKey()
-			elems[hashKey] = v
+// evalDoExpression evaluates the block of a do expression in a new scope, so its lets end with it. The value of its last
+// statement is used when asValue is set.
+func evalDoExpression(de *ast.DoExpression, env *object.Environment, asValue bool) object.Object {
+	result := evalBlock(de.Body, object.NewEnvironment(env), asValue)
+	if object.IsReturnValue(result) || object.IsErrorValue(result) {
+		return result
+	}
+	statements := de.Body.Statements
+	if len(statements) == 0 || result == nil {
+		return object.NULL
+	}
+	if _, ok := statements[len(statements)-1].(*ast.ExpressionStatement); !ok {
+		return object.NULL // like in the VM, only an expression gives the block a value
+	}
+	return result
+}
+
+// evalHashLiteral builds a hash from alternating keys and values, in source order so a repeated key keeps its last
+// value.
+func evalHashLiteral(pairs []object.Object) object.Object {
+	ho := object.NewHash()
+	for i := 0; i < len(pairs); i += 2 {
+		if err := ho.Set(pairs[i], pairs[i+1]); err != nil {
+			return object.NewError(err.Error())
 		}
 	}
-	ho.Pairs = elems
 	return ho
 }
 
@@ -1,12 +1,17 @@
 package evaluator
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"github.com/jatin-malik/yal/lexer"
 	"github.com/jatin-malik/yal/object"
 	"github.com/jatin-malik/yal/parser"
+	"io"
+	"os"
+	"slices"
 	"testing"
+	"time"
 )
 
 func TestEvalIntegerLiteral(t *testing.T) {
@@ -81,6 +86,23 @@ func TestEvalBooleanLiteral(t *testing.T) {
 		{"!!true", true},
 		{"!!!false", true},
 		{"!5", false},
+
+		// ! uses truthiness: only false and null are falsy, so 0, "" and empty collections are truthy
+		{`!0`, false},
+		{`!-1`, false},
+		{`!""`, false},
+		{`!"false"`, false},
+		{`![]`, false},
+		{`![false]`, false},
+		{`!{}`, false},
+		{`!fn() { false }`, false},
+		{`!len`, false},
+		{`!if (false) { 1 }`, true},
+		{`!{"a": 1}.b`, true},
+		{`!!if (false) { 1 }`, false},
+		{`!!0`, true},
+		{`!!""`, true},
+		{`!![]`, true},
 	}
 
 	for _, tt := range tests {
@@ -440,6 +462,18 @@ func TestEvalFunctions(t *testing.T) {
 		// ================================
 		{`let multiplyBy = fn(x) { return fn(y) { return x * y; }; }; let multiplyByTwo = multiplyBy(2); multiplyByTwo(3);`, 6}, // higher-order function returning another function
 		{`let applyFn = fn(f, x) { return f(x); }; applyFn(fn(x) { return x + 1; }, 5);`, 6},                                    // higher-order function that accepts another function
+
+		// ================================
+		// Indexing Call Results and Calling Index Results
+		// ================================
+		{`let getArray = fn() { [10, 20, 30] }; getArray()[0]`, 10},
+		{`let getArray = fn() { [10, 20, 30] }; getArray()[1 + 1]`, 30},
+		{`let h = fn() { {"k": "v"} }; h()["k"]`, "v"},
+		{`let arr = [fn() { "first" }, fn(a) { a + 1 }]; arr[0]()`, "first"},
+		{`let arr = [fn() { "first" }, fn(a) { a + 1 }]; arr[1](41)`, 42},
+		{`let h = fn() { {"double": fn(x) { x * 2 }} }; h()["double"](4)`, 8},
+		{`let mk = fn() { fn() { [1, [2, 3]] } }; mk()()[1][0]`, 2},
+		{`let f = fn(n) { [n, n * 2] }; -f(3)[1] + f(1)[0]`, -5},
 	}
 
 	// Running each test
@@ -451,6 +485,8 @@ func TestEvalFunctions(t *testing.T) {
 				testIntegerObject(t, obj, int64(expected))
 			case bool:
 				testBooleanObject(t, obj, expected)
+			case string:
+				testStringObject(t, obj, expected)
 			}
 		})
 	}
@@ -478,7 +514,7 @@ func TestEvalArrays(t *testing.T) {
 		{`[1, 2, 3][0]`, int64(1)}, // Access first element
 		{`[1, 2, 3][1]`, int64(2)}, // Access second element
 		{`[1, 2, 3][2]`, int64(3)}, // Access third element
-		{`[1, 2, 3][3]`, errors.New("index out of bounds for arr length 3")}, // Access out of bounds (null)
+		{`[1, 2, 3][3]`, errors.New("index 3 out of bounds for arr length 3")}, // Access out of bounds (null)
 
 		{`[[1, 2], [3, 4]][0][1]`, int64(2)}, // Access second element of the first nested array
 
@@ -546,8 +582,20 @@ func TestEvalHashAccess(t *testing.T) {
 		// ================================
 		{`{[1,2]: "array"}[2]`, errors.New("key type ARRAY is not hashable")},      // Invalid key type: array as a key
 		{`{"name": "Alice"}[[1,2]]`, errors.New("key type ARRAY is not hashable")}, // Invalid key type: array as a key
+		{`let f = fn(x) { x }; {f: 1}`, errors.New("key type FUNCTION is not hashable")},
+		{`let f = fn(x) { x }; {"a": 1}[f]`, errors.New("key type FUNCTION is not hashable")},
+		{`let f = fn(x) { x }; let h = {"a": 1, f: 2}; h`, errors.New("key type FUNCTION is not hashable")}, // no half-built hash is bound
+		{`{quote(1 + 2): 1}`, errors.New("key type QUOTE is not hashable")},
 		{`{true: "yes"}[1]`, nil},
 
+		// ================================
+		// Null Keys
+		// ================================
+		{`let null = if (false) { 0 }; {null: "x"}[null]`, "x"},                   // null as a key
+		{`let null = {}.missing; {null: "x", "null": "y"}[null]`, "x"},            // distinct from the string "null"
+		{`let null = if (false) { 0 }; {"null": "y"}[null]`, nil},                 // missing null key
+		{`let null = if (false) { 0 }; let h = {null: 1}; h[null] + 1`, int64(2)}, // through a binding
+
 		// ================================
 		// Nested Hash Access
 		// ================================
@@ -586,6 +634,68 @@ func TestEvalHashAccess(t *testing.T) {
 		// ================================
 		{`{"user": {"name": "Bob"}}["user"]["name"]`, "Bob"},     // Access name from "user"
 		{`{"user": {"name": "Alice"}}["user"]["name"]`, "Alice"}, // Access name from "user"
+
+		// ================================
+		// Repeated Keys
+		// ================================
+		{`{"a": 1, "a": 2}["a"]`, int64(2)},         // The last value wins
+		{`{"a": 1, "b": 2, "a": 3}["a"]`, int64(3)}, // Even with other keys in between
+		{`let h = {1: "x", 1: "y"}; h[1]`, "y"},     // Integer keys too
+
+		// ================================
+		// Dot Access
+		// ================================
+		{`{"a": 1}.a`, int64(1)},                                                            // Dot access on a literal
+		{`let h = {"name": "Alice"}; h.name`, "Alice"},                                      // Dot access on a binding
+		{`{"person": {"name": "Alice"}}.person.name`, "Alice"},                              // Chained dot access
+		{`{"person": {"name": "Alice"}}.person["name"]`, "Alice"},                           // Dot access mixed with brackets
+		{`{"a": 1}.b`, nil},                                                                 // Missing key
+		{`let h = {"add": fn(a, b) { a + b }}; h.add(1, 2)`, int64(3)},                      // Calling a member
+		{`[1, 2].a`, errors.New("index must be an integer for index expression in arrays")}, // Dot access on an array
+		{`{"len": 5}.len`, int64(5)},                                                        // Member named like a builtin, not called
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			obj := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case int64:
+				testIntegerObject(t, obj, expected)
+			case string:
+				testStringObject(t, obj, expected)
+			case bool:
+				testBooleanObject(t, obj, expected)
+			case nil:
+				testNullObject(t, obj)
+			case error:
+				testErrorObject(t, obj, expected.Error())
+			default:
+				t.Errorf("unexpected type %T for expected value: %v", expected, expected)
+			}
+		})
+	}
+}
+
+func TestEvalMethodCalls(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`[1, 2].len()`, int64(2)},
+		{`"héllo".len()`, int64(5)},
+		{`[1].push(2)`, []interface{}{int64(1), int64(2)}},
+		{`let arr = [1, 2, 3]; arr.rest().first()`, int64(2)},
+		{`[1].push(2).push(3).len()`, int64(3)},
+		{`let h = {"double": fn(x) { x * 2 }}; h.double(4)`, int64(8)},
+		{`1.len()`, errors.New("len(): type INTEGER not supported")},
+
+		// a hash member named like a builtin is called rather than the builtin
+		{`let m = {"first": fn(x) { x }}; m.first(5)`, int64(5)},
+		{`let m = {"len": fn() { 7 }}; m.len()`, int64(7)},
+		{`{"a": 1, "b": 2}.len()`, errors.New("len(): type HASH not supported")},
+		{`let len = fn(x) { 42 }; [1].len()`, int64(42)},
+		{`{"a": 1}.missing()`, errors.New("expected *object.Function, got NULL")},
 	}
 
 	for _, tt := range tests {
@@ -599,6 +709,8 @@ func TestEvalHashAccess(t *testing.T) {
 				testStringObject(t, obj, expected)
 			case bool:
 				testBooleanObject(t, obj, expected)
+			case []interface{}:
+				testArrayObject(t, obj, expected)
 			case nil:
 				testNullObject(t, obj)
 			case error:
@@ -610,6 +722,65 @@ func TestEvalHashAccess(t *testing.T) {
 	}
 }
 
+func TestEvalMatchExpression(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// Array patterns
+		{`match ([1, 2]) { [a, b] => a + b; n => n }`, int64(3)},
+		{`match ([1, 2, 3]) { [a, b] => a + b; n => len(n) }`, int64(3)},
+		{`match ([1, [2, 3]]) { [a, [b, c]] => a + b + c }`, int64(6)},
+		{`match ([1, 2]) { [1, x] => x; _ => 0 }`, int64(2)},
+		{`match ([3, 2]) { [1, x] => x; _ => 0 }`, int64(0)},
+
+		// Hash patterns
+		{`match ({"x": 5, "y": 6}) { {x: x} => x; n => n }`, int64(5)},
+		{`match ({"x": 5}) { {y: y} => y; {x: x} => x * 2 }`, int64(10)},
+		{`match ({"point": [1, 2]}) { {"point": [a, b]} => b }`, int64(2)},
+		{`match ({1: "one"}) { {1: name} => name }`, "one"},
+
+		// Literal patterns
+		{`match (2) { 1 => "one"; 2 => "two"; _ => "many" }`, "two"},
+		{`match (-1) { -1 => "minus one"; _ => "other" }`, "minus one"},
+		{`match ("yes") { "no" => false; "yes" => true }`, true},
+		{`match (true) { false => 0; true => 1 }`, int64(1)},
+		{`match ("1") { 1 => "int"; _ => "other" }`, "other"},
+
+		// Catch-all
+		{`match (42) { [a] => a; {x: x} => x; n => n + 1 }`, int64(43)},
+		{`match (42) { _ => "anything" }`, "anything"},
+
+		// Scoping
+		{`let a = 1; let r = match ([5]) { [a] => a }; a + r`, int64(6)},
+		{`let f = fn(v) { match (v) { [h, t] => h * t; _ => 0 } }; f([3, 4]) + f(1)`, int64(12)},
+		{`match ([1]) { [a] => a }; a`, errors.New("Undefined variable \"a\"")},
+
+		// No match
+		{`match (1) { 2 => 2 }`, errors.New("no pattern matched the value")},
+		{`match ([1]) { [a, b] => a }`, errors.New("no pattern matched the value")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			obj := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case int64:
+				testIntegerObject(t, obj, expected)
+			case string:
+				testStringObject(t, obj, expected)
+			case bool:
+				testBooleanObject(t, obj, expected)
+			case error:
+				testErrorObject(t, obj, expected.Error())
+			default:
+				t.Errorf("unexpected type %T for expected value: %v", expected, expected)
+			}
+		})
+	}
+}
+
 func TestEvalStringConcatenation(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -652,6 +823,71 @@ func TestEvalStringConcatenation(t *testing.T) {
 	}
 }
 
+func TestEvalStringRepetition(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"ab" * 3`, "ababab"},
+		{`"x" * 1`, "x"},
+		{`"x" * 0`, ""},
+		{`"x" * -2`, ""},
+		{`"" * 5`, ""},
+		{`let s = "-"; s * 2 + ">"`, "-->"},
+		{`"日本" * 2`, "日本日本"},
+		{`3 * "ab"`, errors.New("Incompatible types: INTEGER and STRING")}, // only string * int is supported
+		{`"ab" - 1`, errors.New("Incompatible types: STRING and INTEGER")},
+		{`"ab" * 9223372036854775807`,
+			errors.New("string too long: repeating 2 bytes 9223372036854775807 times exceeds 134217728 bytes")},
+		{`"ab" * 100000000`, errors.New("string too long: repeating 2 bytes 100000000 times exceeds 134217728 bytes")},
+		{`"" * 9223372036854775807`, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			obj := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case string:
+				testStringObject(t, obj, expected)
+			case error:
+				testErrorObject(t, obj, expected.Error())
+			default:
+				t.Errorf("unexpected type %T for expected value: %v", expected, expected)
+			}
+		})
+	}
+}
+
+func TestEvalStringIndex(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`"hello"[0]`, "h"},
+		{`"hello"[4]`, "o"},
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[2]`, "l"},
+		{`"日本語"[2]`, "語"},
+		{`let s = "héllo"; s[len(s) - 1]`, "o"},
+		{`"héllo"[5]`, errors.New("index 5 out of bounds for string length 5")},
+		{`"héllo"[-1]`, errors.New("index -1 out of bounds for string length 5")},
+		{`"hello"["a"]`, errors.New("index must be an integer for index expression in strings")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			obj := testEval(tt.input)
+			switch expected := tt.expected.(type) {
+			case string:
+				testStringObject(t, obj, expected)
+			case error:
+				testErrorObject(t, obj, expected.Error())
+			}
+		})
+	}
+}
+
 func TestEvalWithMacros(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -750,6 +986,18 @@ func TestEvalWithMacros(t *testing.T) {
 			invalid("hello")`,
 			fmt.Errorf("Incompatible types: STRING and INTEGER"),
 		},
+
+		// 7. Macros inside a match subject and arms
+		{`
+			let double = macro(x) { quote(unquote(x) * 2) };
+			match (double(3)) { 6 => double(4); _ => 0 }`,
+			8,
+		},
+		{`
+			let m = macro(x) { quote(unquote(x) * 2) };
+			match (3) { n => m(n) };`,
+			6,
+		},
 	}
 
 	for _, tt := range tests {
@@ -820,6 +1068,13 @@ func TestEvalBuiltInFuncLen(t *testing.T) {
 		// ================================
 		{`len("a" + "")`, 1},         // Concatenation with an empty string
 		{`len("") + len("test")`, 4}, // Adding lengths of two strings
+
+		// ================================
+		// Multi-byte Characters
+		// ================================
+		{`len("héllo")`, 5},   // Characters, not bytes, are counted
+		{`len("日本語")`, 3},     // Three characters of three bytes each
+		{`len("é" + "e")`, 2}, // Concatenation with a multi-byte character
 	}
 
 	for _, tt := range tests {
@@ -1090,103 +1345,658 @@ func TestEvalBuiltInFuncPush(t *testing.T) {
 	}
 }
 
-func TestLooping(t *testing.T) {
+func TestEvalBuiltInFuncPrint(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedOutput string
+		expectedError  string
+	}{
+		{`print("a", "b", 1)`, "a b 1\n", ""},
+		{`print()`, "\n", ""},
+		{`print("a", "b", {"sep": ", "})`, "a, b\n", ""},
+		{`print("a", "b", {"end": "!"})`, "a b!", ""},
+		{`print(1, 2, 3, {"sep": "-", "end": ""})`, "1-2-3", ""},
+		{`print({"sep": "-"})`, "\n", ""},
+		{`print("a", {"sep": 1})`, "", "print(): option sep must be a STRING, got INTEGER"},
+		{`print("a", {"foo": "bar"})`, "", "print(): unknown option foo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var out bytes.Buffer
+			object.Output = &out
+			defer func() { object.Output = os.Stdout }()
+
+			obj := testEval(tt.input)
+			if tt.expectedError != "" {
+				testErrorObject(t, obj, tt.expectedError)
+				return
+			}
+			testNullObject(t, obj)
+			if out.String() != tt.expectedOutput {
+				t.Errorf("expected output %q, got %q", tt.expectedOutput, out.String())
+			}
+		})
+	}
+}
+
+func TestEvalBuiltInFuncMatch(t *testing.T) {
 	tests := []struct {
 		input    string
 		expected interface{}
 	}{
-		// ✅ Basic Loop: Counting from 0 to 9
-		{
-			`
-		let i = 0;
-		let result = 0;
-		loop (i < 10) {
-			let result = result + 1;
-			let i = i + 1;
-		}
-		result;
-		`,
-			10,
-		},
+		{`match("abc123", "[0-9]+")`, true},
+		{`match("abc", "^[0-9]+$")`, false},
+		{`match("2024", "^[0-9]+$")`, true},
+		{`match("abc", "(")`, errors.New("match(): invalid pattern: error parsing regexp: missing closing ): `(`")},
+		{`match("abc")`, errors.New("match() requires 2 arguments. got 1")},
+		{`match("abc", 1)`, errors.New("match(): type INTEGER not supported")},
+	}
 
-		// ✅ Loop with String Concatenation
-		{
-			`
-		let i = 0;
-		let result = "";
-		loop (i < 3) {
-			let result = result + "hi ";
-			let i = i + 1;
-		}
-		result;
-		`,
-			"hi hi hi ",
-		},
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			obj := testEval(tt.input)
+			switch expected := tt.expected.(type) {
+			case bool:
+				testBooleanObject(t, obj, expected)
+			case error:
+				testErrorObject(t, obj, expected.Error())
+			}
+		})
+	}
+}
 
-		// ✅ Loop with Multiplication
-		{
-			`
-		let i = 1;
-		let result = 1;
-		loop (i < 6) {
-			let result = result * i;
-			let i = i + 1;
-		}
-		result;
-		`,
-			120, // 1 * 2 * 3 * 4 * 5
-		},
+func TestEvalBuiltInFuncFindAll(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`find_all("the quick brown fox", "[a-z]+")`, []interface{}{"the", "quick", "brown", "fox"}},
+		{`find_all("a1b22c333", "[0-9]+")`, []interface{}{"1", "22", "333"}},
+		{`find_all("abc", "[0-9]+")`, []interface{}{}},
+		{`find_all("abc", "[")`, errors.New("find_all(): invalid pattern: error parsing regexp: missing closing ]: `[`")},
+	}
 
-		// ✅ Nested Loops
-		{
-			`
-		let i = 0;
-		let j = 0;
-		let result = 0;
-		loop (i < 3) {
-			let j = 0;
-			loop (j < 2) {
-				let result = result + 1;
-				let j = j + 1;
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			obj := testEval(tt.input)
+			switch expected := tt.expected.(type) {
+			case []interface{}:
+				testArrayObject(t, obj, expected)
+			case error:
+				testErrorObject(t, obj, expected.Error())
 			}
-			let i = i + 1;
-		}
-		result;
-		`,
-			6, // Runs 3 * 2 times
-		},
+		})
+	}
+}
 
-		// ✅ Loop That Never Runs
-		{
-			`
-		let i = 10;
-		let result = 100;
-		loop (i < 5) {
-			let result = result - 1;
-			let i = i + 1;
-		}
-		result;
-		`,
-			100, // Condition `i < 5` is false at start
-		},
+func TestEvalBuiltInFuncEnv(t *testing.T) {
+	defer fakeEnv(map[string]string{"HOME": "/home/yal", "EMPTY": ""})()
 
-		// ✅ Loop with Boolean Condition
-		{
-			`
-		let i = 0;
-		let shouldRun = true;
-		let result = 0;
-		loop (shouldRun) {
-			let result = result + 1;
-			if (result == 5) { let shouldRun = false; }
-		}
-		result;
-		`,
-			5, // Stops when `shouldRun` becomes `false`
-		},
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`getenv("HOME")`, "/home/yal"},
+		{`getenv("EMPTY")`, ""},
+		{`getenv("MISSING")`, nil},
+		{`setenv("LANG", "yal"); getenv("LANG")`, "yal"},
+		{`getenv(1)`, errors.New("getenv(): type INTEGER not supported")},
+		{`setenv("LANG", 1)`, errors.New("setenv(): type INTEGER not supported")},
+	}
 
-		// ✅ Loop with List Append
-		{
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			obj := testEval(tt.input)
+			switch expected := tt.expected.(type) {
+			case string:
+				testStringObject(t, obj, expected)
+			case nil:
+				testNullObject(t, obj)
+			case error:
+				testErrorObject(t, obj, expected.Error())
+			}
+		})
+	}
+}
+
+func TestEvalBuiltInFuncSleep(t *testing.T) {
+	var slept []time.Duration
+	object.Sleep = func(d time.Duration) { slept = append(slept, d) }
+	defer func() { object.Sleep = time.Sleep }()
+
+	tests := []struct {
+		input    string
+		expected interface{}
+		slept    []time.Duration
+	}{
+		{`sleep(250)`, nil, []time.Duration{250 * time.Millisecond}},
+		{`sleep(0); sleep(1)`, nil, []time.Duration{0, time.Millisecond}},
+		{`sleep(-1)`, errors.New("sleep(): negative duration -1"), nil},
+		{`sleep("1")`, errors.New("sleep(): type STRING not supported"), nil},
+		{`sleep()`, errors.New("sleep() requires 1 argument. got 0"), nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			slept = nil
+			obj := testEval(tt.input)
+			switch expected := tt.expected.(type) {
+			case nil:
+				testNullObject(t, obj)
+			case error:
+				testErrorObject(t, obj, expected.Error())
+			}
+			if !slices.Equal(slept, tt.slept) {
+				t.Errorf("expected sleeps %v, got %v", tt.slept, slept)
+			}
+		})
+	}
+}
+
+func TestEvalInterrupted(t *testing.T) {
+	polls := 0
+	object.Interrupted = func() bool {
+		polls++
+		return polls > 50
+	}
+	defer func() { object.Interrupted = nil }()
+
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let i = 0; loop (i < 10) { let i = i + 1; } i`, 10}, // fewer polls than it takes to interrupt
+		{`loop (true) { }`, errors.New("interrupted")},
+		{`let f = fn(n) { f(n + 1) }; f(0)`, errors.New("interrupted")},
+		{`let f = fn() { 1 }; f()`, errors.New("interrupted")}, // stays interrupted until Interrupted says otherwise
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			obj := testEval(tt.input)
+			switch expected := tt.expected.(type) {
+			case int:
+				testIntegerObject(t, obj, int64(expected))
+			case error:
+				testErrorObject(t, obj, expected.Error())
+			}
+		})
+	}
+}
+
+func TestEvalBuiltInFuncClone(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`clone([1, [2, 3]])`, []interface{}{int64(1), []interface{}{int64(2), int64(3)}}},
+		{`let a = [1]; let b = push(clone(a), 2); a`, []interface{}{int64(1)}},
+		{`clone({"a": [1]})["a"]`, []interface{}{int64(1)}},
+		{`clone(5)`, int64(5)},
+		{`clone("yal")`, "yal"},
+		{`clone()`, errors.New("clone() requires 1 argument. got 0")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			obj := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case int64:
+				testIntegerObject(t, obj, expected)
+			case string:
+				testStringObject(t, obj, expected)
+			case []interface{}:
+				testArrayObject(t, obj, expected)
+			case error:
+				testErrorObject(t, obj, expected.Error())
+			default:
+				t.Errorf("unexpected type %T for expected value: %v", expected, expected)
+			}
+		})
+	}
+}
+
+func TestEvalBuiltInFuncFreeze(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let a = freeze([1]); push(a, 2)`, errors.New("cannot modify frozen value")},
+		{`let a = [1]; freeze(a); push(a, 2)`, errors.New("cannot modify frozen value")},
+		{`let a = freeze([1, 2]); a[1]`, int64(2)},
+		{`freeze({"a": 1}).a`, int64(1)},
+		{`push(clone(freeze([1])), 2)`, []interface{}{int64(1), int64(2)}},
+		{`freeze(5)`, int64(5)},
+		{`freeze()`, errors.New("freeze() requires 1 argument. got 0")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			obj := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case int64:
+				testIntegerObject(t, obj, expected)
+			case []interface{}:
+				testArrayObject(t, obj, expected)
+			case error:
+				testErrorObject(t, obj, expected.Error())
+			default:
+				t.Errorf("unexpected type %T for expected value: %v", expected, expected)
+			}
+		})
+	}
+}
+
+func TestEvalBuiltInFuncArity(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`arity(fn(x, y) {})`, int64(2)},
+		{`arity(fn() { 1 })`, int64(0)},
+		{`let add = fn(a, b, c) { a + b + c }; arity(add)`, int64(3)},
+		{`let make = fn() { fn(x) { x } }; arity(make())`, int64(1)},
+		{`arity(1)`, errors.New("arity(): type INTEGER not supported")},
+		{`arity(len)`, errors.New("arity(): type BUILTIN_FUNCTION not supported")},
+		{`arity()`, errors.New("arity() requires 1 argument. got 0")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			obj := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case int64:
+				testIntegerObject(t, obj, expected)
+			case error:
+				testErrorObject(t, obj, expected.Error())
+			default:
+				t.Errorf("unexpected type %T for expected value: %v", expected, expected)
+			}
+		})
+	}
+}
+
+func TestEvalBuiltInFuncPartial(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let add = fn(a, b) { a + b }; partial(add, 5)(3)`, int64(8)},
+		{`let add = fn(a, b) { a + b }; let inc = partial(add, 1); inc(inc(1))`, int64(3)},
+		{`let sub = fn(a, b, c) { a - b - c }; partial(partial(sub, 10), 2)(3)`, int64(5)},
+		{`let add = fn(a, b) { a + b }; partial(add, 1, 2)()`, int64(3)},
+		{`let f = fn(a) { a }; partial(f)(7)`, int64(7)},
+		{`partial(push, [1])(2)`, []interface{}{int64(1), int64(2)}},
+		{`let add = fn(a, b) { a + b }; arity(partial(add, 5))`, int64(1)},
+		{`let add = fn(a, b) { a + b }; partial(add, 5)(3, 4)`, errors.New("expected 2 parameters, got 3 args")},
+		{`partial(1, 2)`, errors.New("partial(): type INTEGER not supported")},
+		{`partial()`, errors.New("partial() requires at least 1 argument. got 0")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			obj := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case int64:
+				testIntegerObject(t, obj, expected)
+			case []interface{}:
+				testArrayObject(t, obj, expected)
+			case error:
+				testErrorObject(t, obj, expected.Error())
+			default:
+				t.Errorf("unexpected type %T for expected value: %v", expected, expected)
+			}
+		})
+	}
+}
+
+func TestEvalBuiltInFuncComposeAndPipe(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let inc = fn(x) { x + 1 }; let dbl = fn(x) { x * 2 }; compose(inc, dbl)(3)`, int64(7)},
+		{`let inc = fn(x) { x + 1 }; let dbl = fn(x) { x * 2 }; pipe(inc, dbl)(3)`, int64(8)},
+		{`let inc = fn(x) { x + 1 }; let dbl = fn(x) { x * 2 }; compose(inc, compose(dbl, inc))(1)`, int64(5)},
+		{`let inc = fn(x) { x + 1 }; let f = pipe(inc, inc); [f(1), f(f(1))]`, []interface{}{int64(3), int64(5)}},
+		{`let inc = fn(x) { x + 1 }; let add = fn(a, b) { a + b }; pipe(add, inc)(2, 3)`, int64(6)},
+		{`let inc = fn(x) { x + 1 }; pipe(rest, len)([1, 2, 3])`, int64(2)},
+		{`pipe(rest, len)([1, 2, 3])`, int64(2)},
+		{`let inc = fn(x) { x + 1 }; pipe(inc, len)(1)`, errors.New("len(): type INTEGER not supported")},
+		{`compose(fn(x) { x }, 1)`, errors.New("compose(): type INTEGER not supported")},
+		{`pipe(fn(x) { x })`, errors.New("pipe() requires 2 arguments. got 1")},
+		{`let add = fn(a, b) { a + b }; let f = fn(x) { pipe(partial(add, x), fn(y) { y * x })(1) }; 1 + f(3)`, int64(13)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			obj := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case int64:
+				testIntegerObject(t, obj, expected)
+			case []interface{}:
+				testArrayObject(t, obj, expected)
+			case error:
+				testErrorObject(t, obj, expected.Error())
+			default:
+				t.Errorf("unexpected type %T for expected value: %v", expected, expected)
+			}
+		})
+	}
+}
+
+func TestEvalBuiltInFuncDeepEqual(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`deepequal([1, [2, 3]], [1, [2, 3]])`, true},
+		{`deepequal([1, [2, 3]], [1, [2, 4]])`, false},
+		{`deepequal([1, 2], [1, 2, 3])`, false},
+		{`deepequal({"a": [1], "b": {"c": true}}, {"b": {"c": true}, "a": [1]})`, true},
+		{`deepequal({"a": 1}, {"a": 2})`, false},
+		{`deepequal({"a": 1}, {"b": 1})`, false},
+		{`deepequal(1, "1")`, false},
+		{`deepequal([1], {1: 1})`, false},
+		{`deepequal([], [])`, true},
+		{`[1, [2]] == [1, [2]]`, true},
+		{`[1, [2]] != [1, [2]]`, false},
+		{`{"a": [1, 2]} == {"a": [1, 2]}`, true},
+		{`{"a": [1, 2]} != {"a": [2, 1]}`, true},
+		{`let a = [1, 2]; let b = push(a, 3); a == b`, false},
+		{`deepequal(1)`, errors.New("deepequal() requires 2 arguments. got 1")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			obj := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case bool:
+				testBooleanObject(t, obj, expected)
+			case error:
+				testErrorObject(t, obj, expected.Error())
+			default:
+				t.Errorf("unexpected type %T for expected value: %v", expected, expected)
+			}
+		})
+	}
+}
+
+func TestEvalForwardReferences(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let f = fn() { g() + 1 }; let g = fn() { 41 }; f()`, int64(42)},
+		{`let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } }; let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } }; isEven(10)`, true},
+		{`let f = fn() { limit * 2 }; let limit = 5; f()`, int64(10)},
+		{`let f = fn() { g() }; f(); let g = fn() { 1 };`, errors.New(`Undefined variable "g"`)},
+		{`x + 1; let x = 2;`, errors.New(`Undefined variable "x"`)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			obj := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case int64:
+				testIntegerObject(t, obj, expected)
+			case bool:
+				testBooleanObject(t, obj, expected)
+			case error:
+				testErrorObject(t, obj, expected.Error())
+			default:
+				t.Errorf("unexpected type %T for expected value: %v", expected, expected)
+			}
+		})
+	}
+}
+
+func TestEvalBuiltInFuncJustify(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`rjust(7, 3)`, "  7"},
+		{`ljust(7, 3) + "|"`, "7  |"},
+		{`rjust("yal", 5)`, "  yal"},
+		{`rjust("héllo", 6)`, " héllo"},
+		{`rjust(12345, 3)`, "12345"},
+		{`rjust(-42, 4)`, " -42"},
+		{`ljust("x", 0)`, "x"},
+		{`let rows = [7, 42, 1234]; let i = 0; let table = ""; loop (i < len(rows)) { let table = table + rjust(rows[i], 5) + "|"; let i = i + 1; } table`, "    7|   42| 1234|"},
+		{`rjust(true, 3)`, errors.New("rjust(): type BOOLEAN not supported")},
+		{`ljust("a", "3")`, errors.New("ljust(): width must be an integer, got STRING")},
+		{`rjust(1)`, errors.New("rjust() requires 2 arguments. got 1")},
+		{`rjust(1, 9223372036854775807)`, errors.New("rjust(): width 9223372036854775807 exceeds 134217728")},
+		{`ljust("a", 134217729)`, errors.New("ljust(): width 134217729 exceeds 134217728")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			obj := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case string:
+				testStringObject(t, obj, expected)
+			case error:
+				testErrorObject(t, obj, expected.Error())
+			default:
+				t.Errorf("unexpected type %T for expected value: %v", expected, expected)
+			}
+		})
+	}
+}
+
+func TestEvalShadowedBuiltins(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let len = fn(x) { 42 }; len("hi")`, int64(42)},
+		{`len("hi")`, int64(2)},
+		{`let a = len("hi"); let len = fn(x) { 42 }; [a, len("hi")]`, []interface{}{2, 42}},
+		{`let f = fn() { let len = fn(x) { 1 }; len("abc") }; [f(), len("abc")]`, []interface{}{1, 3}},
+		{`let first = fn(arr) { last(arr) }; [first([1, 2]), rest([1, 2])]`, []interface{}{2, []interface{}{2}}},
+		{`let push = 5; push`, int64(5)},
+		{`let f = fn(s) { len(s) }; let len = fn(s) { 42 }; f("abc")`, int64(42)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			obj := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case int64:
+				testIntegerObject(t, obj, expected)
+			case []interface{}:
+				testArrayObject(t, obj, expected)
+			default:
+				t.Errorf("unexpected type %T for expected value: %v", expected, expected)
+			}
+		})
+	}
+}
+
+func TestEvalProgramWithoutValue(t *testing.T) {
+	defer func(previous io.Writer) { object.Output = previous }(object.Output)
+	object.Output = io.Discard
+
+	inputs := []string{
+		"",
+		"  \n\t",
+		"# nothing to run",
+		"# one\n# two\n",
+		"1; let x = 2;",
+		"puts(1); let i = 0; loop (i < 2) { let i = i + 1; }",
+		"let m = macro(a) { a };",
+	}
+
+	for _, input := range inputs {
+		t.Run(input, func(t *testing.T) {
+			if obj := testEval(input); obj != nil {
+				t.Errorf("expected no value, got %s", obj.Inspect())
+			}
+		})
+	}
+
+	testIntegerObject(t, testEval("1; # the last statement is the value"), 1)
+}
+
+func TestEvalFlushesBufferedOutput(t *testing.T) {
+	defer func(previous io.Writer) { object.Output, object.BufferOutput = previous, false }(object.Output)
+	var out bytes.Buffer
+	object.Output, object.BufferOutput = &out, true
+
+	obj := testEval(`puts("a"); "b"`)
+	if out.String() != "a\n" {
+		t.Errorf("expected the output written when Eval returns, got %q", out.String())
+	}
+	testStringObject(t, obj, "b")
+}
+
+func TestEvalDoExpressions(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		{`let y = do { let a = 2; a * 3 }; y`, int64(6)},
+		{`let a = 100; let y = do { let a = 2; a }; [a, y]`, []interface{}{100, 2}},
+		{`1 + do { 5; 2 } * 10`, int64(21)},
+		{`let f = fn(x) { let t = do { let x = x + 1; let x = x * 2; x }; [x, t] }; f(1)`, []interface{}{1, 4}},
+		{`let g = fn(n) { let r = do { if (n > 0) { return "early"; } n }; "late" }; [g(1), g(-1)]`, []interface{}{"early", "late"}},
+		{`let f = fn(a) { do { let b = a + 1; fn() { a + b } } }; f(1)()`, int64(3)},
+		{`let k = do { let secret = 7; fn() { secret } }; k()`, int64(7)},
+		{`do { let a = 5; }`, nil},
+		{`do { }`, nil},
+		{`[do { 1 }, do { 2 }]`, []interface{}{1, 2}},
+		{`do { let a = 1; }; a`, errors.New("Undefined variable \"a\"")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			obj := testEval(tt.input)
+
+			switch expected := tt.expected.(type) {
+			case int64:
+				testIntegerObject(t, obj, expected)
+			case []interface{}:
+				testArrayObject(t, obj, expected)
+			case error:
+				testErrorObject(t, obj, expected.Error())
+			case nil:
+				testNullObject(t, obj)
+			default:
+				t.Errorf("unexpected type %T for expected value: %v", expected, expected)
+			}
+		})
+	}
+}
+
+func TestLooping(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected interface{}
+	}{
+		// ✅ Basic Loop: Counting from 0 to 9
+		{
+			`
+		let i = 0;
+		let result = 0;
+		loop (i < 10) {
+			let result = result + 1;
+			let i = i + 1;
+		}
+		result;
+		`,
+			10,
+		},
+
+		// ✅ Loop with String Concatenation
+		{
+			`
+		let i = 0;
+		let result = "";
+		loop (i < 3) {
+			let result = result + "hi ";
+			let i = i + 1;
+		}
+		result;
+		`,
+			"hi hi hi ",
+		},
+
+		// ✅ Loop with Multiplication
+		{
+			`
+		let i = 1;
+		let result = 1;
+		loop (i < 6) {
+			let result = result * i;
+			let i = i + 1;
+		}
+		result;
+		`,
+			120, // 1 * 2 * 3 * 4 * 5
+		},
+
+		// ✅ Nested Loops
+		{
+			`
+		let i = 0;
+		let j = 0;
+		let result = 0;
+		loop (i < 3) {
+			let j = 0;
+			loop (j < 2) {
+				let result = result + 1;
+				let j = j + 1;
+			}
+			let i = i + 1;
+		}
+		result;
+		`,
+			6, // Runs 3 * 2 times
+		},
+
+		// ✅ Loop That Never Runs
+		{
+			`
+		let i = 10;
+		let result = 100;
+		loop (i < 5) {
+			let result = result - 1;
+			let i = i + 1;
+		}
+		result;
+		`,
+			100, // Condition `i < 5` is false at start
+		},
+
+		// ✅ Loop with Boolean Condition
+		{
+			`
+		let i = 0;
+		let shouldRun = true;
+		let result = 0;
+		loop (shouldRun) {
+			let result = result + 1;
+			if (result == 5) { let shouldRun = false; }
+		}
+		result;
+		`,
+			5, // Stops when `shouldRun` becomes `false`
+		},
+
+		// ✅ Loop with List Append
+		{
 			`
 		let i = 0;
 		let list = [];
@@ -1199,6 +2009,57 @@ func TestLooping(t *testing.T) {
 			[]interface{}{0, 1, 2}, // Should store `[0, 1, 2]`
 		},
 
+		// ✅ Return From Inside a Loop Leaves the Function
+		{
+			`
+		let find = fn(arr, target) {
+			let i = 0;
+			loop (i < len(arr)) {
+				if (arr[i] == target) { return i; }
+				let i = i + 1;
+			}
+			return -1;
+		};
+		[find([5, 6, 7], 6), find([5, 6, 7], 9)];
+		`,
+			[]interface{}{1, -1},
+		},
+
+		// ✅ Return Skips the Rest of the Function
+		{
+			`
+		let f = fn() {
+			let i = 0;
+			loop (true) {
+				let i = i + 1;
+				if (i == 3) { return i * 10; }
+			}
+			99;
+		};
+		f() + 1;
+		`,
+			31,
+		},
+
+		// ✅ Return From a Nested Loop
+		{
+			`
+		let f = fn(n) {
+			let i = 0;
+			loop (i < n) {
+				let j = 0;
+				loop (j < n) {
+					if (i * j == 6) { return [i, j]; }
+					let j = j + 1;
+				}
+				let i = i + 1;
+			}
+		};
+		f(4);
+		`,
+			[]interface{}{2, 3},
+		},
+
 		// ❌ Loop with Undefined Variable in Condition
 		{
 			`
@@ -1218,7 +2079,7 @@ func TestLooping(t *testing.T) {
 			let i = i + 1;
 		}
 		`,
-			errors.New(`Undefined variable "result"`),
+			errors.New(`Undefined variable "result", did you mean 'rest'?`),
 		},
 	}
 
@@ -1255,6 +2116,14 @@ func TestEvalErrorHandling(t *testing.T) {
 		{"let a = 5; return b;", `Undefined variable "b"`},                // 'b' is not defined
 		{"let a = 5; let b = a + c; return a;", `Undefined variable "c"`}, // 'c' is undefined
 
+		// ================================
+		// Suggestions for Undefined Variables
+		// ================================
+		{"let total = 10; totl", `Undefined variable "totl", did you mean 'total'?`}, // near miss of a binding
+		{`lenn("abc")`, `Undefined variable "lenn", did you mean 'len'?`},            // near miss of a builtin
+		{"let f = fn() { let count = 1; cont }; f()", `Undefined variable "cont", did you mean 'count'?`},
+		{"let total = 10; zebra", `Undefined variable "zebra"`}, // unrelated name
+
 		// ================================
 		// Division by Zero
 		// ================================
@@ -1323,6 +2192,22 @@ func testEval(input string) object.Object {
 	return obj
 }
 
+// fakeEnv swaps the environment used by getenv and setenv for a controlled map and returns a func restoring it.
+func fakeEnv(env map[string]string) func() {
+	object.LookupEnv = func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	object.SetEnv = func(name, value string) error {
+		env[name] = value
+		return nil
+	}
+	return func() {
+		object.LookupEnv = os.LookupEnv
+		object.SetEnv = os.Setenv
+	}
+}
+
 func testIntegerObject(t *testing.T, obj object.Object, expected int64) {
 	if i, ok := obj.(*object.Integer); ok {
 		if i.Value != expected {
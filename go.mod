@@ -2,7 +2,6 @@ module github.com/jatin-malik/yal
 
 go 1.23.3
 
-require (
-	github.com/chzyer/readline v1.5.1 // indirect
-	golang.org/x/sys v0.31.0 // indirect
-)
+require github.com/chzyer/readline v1.5.1
+
+require golang.org/x/sys v0.31.0 // indirect
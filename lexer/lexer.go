@@ -1,27 +1,65 @@
 package lexer
 
 import (
+	"bufio"
+	"bytes"
+	"errors"
 	"github.com/jatin-malik/yal/token"
+	"io"
+	"strings"
+	"unicode/utf8"
 )
 
 type Lexer struct {
-	input string // the input to the lexer i.e the source code
-	pos   int    // the current position to read from
+	reader *bufio.Reader // buffered source code, read incrementally
+	ch     byte          // the current character under examination
+	eof    bool          // whether the source is exhausted
+	err    error         // the first non EOF error returned by the reader
+	line   int           // line of the current character
+	column int           // column of the current character
 }
 
 func New(input string) *Lexer {
-	return &Lexer{
-		input: input,
+	return NewReader(strings.NewReader(input))
+}
+
+// NewReader returns a lexer that reads the source code incrementally from r.
+func NewReader(r io.Reader) *Lexer {
+	l := &Lexer{
+		reader: bufio.NewReader(r),
+		line:   1,
 	}
+	l.readChar()
+	return l
+}
+
+// Err returns the first error encountered while reading the source, other than io.EOF. The lexer stops with an EOF
+// token on such errors.
+func (l *Lexer) Err() error {
+	return l.err
 }
 
 func (l *Lexer) NextToken() token.Token {
 	l.eatWhiteSpace() // whitespaces are just token separators for us
-	if l.pos >= len(l.input) {
+	for !l.eof && l.ch == '#' {
+		// Lexer skips over this. Comments are for mortal humans.
+		l.eatComment()
+		l.eatWhiteSpace()
+	}
+
+	line, column := l.line, l.column
+	tok := l.readToken()
+	tok.Line, tok.Column = line, column
+	return tok
+}
+
+// readToken reads the token starting at the current character.
+func (l *Lexer) readToken() token.Token {
+	if l.eof {
 		return newToken(token.EOF, 0)
 	}
 
-	ch := l.input[l.pos]
+	ch := l.ch
 	var tok token.Token
 
 	switch ch {
@@ -30,10 +68,6 @@ func (l *Lexer) NextToken() token.Token {
 		tok.Type = token.STRING
 	case '+':
 		tok = newToken(token.PLUS, ch)
-	case '#':
-		// Lexer skips over this. Comments are for mortal humans.
-		l.eatComment()
-		return l.NextToken()
 	case ':':
 		tok = newToken(token.COLON, ch)
 	case '-':
@@ -45,7 +79,7 @@ func (l *Lexer) NextToken() token.Token {
 	case '!':
 		nextCh := l.peekNextChar()
 		if nextCh == '=' {
-			l.pos++
+			l.readChar()
 			tok.Type = token.NEQ
 			tok.Literal = "!="
 		} else {
@@ -58,9 +92,13 @@ func (l *Lexer) NextToken() token.Token {
 	case '=':
 		nextCh := l.peekNextChar()
 		if nextCh == '=' {
-			l.pos++
+			l.readChar()
 			tok.Type = token.EQ
 			tok.Literal = "=="
+		} else if nextCh == '>' {
+			l.readChar()
+			tok.Type = token.ARROW
+			tok.Literal = "=>"
 		} else {
 			tok = newToken(token.ASSIGN, ch)
 		}
@@ -80,6 +118,8 @@ func (l *Lexer) NextToken() token.Token {
 		tok = newToken(token.SEMICOLON, ch)
 	case ',':
 		tok = newToken(token.COMMA, ch)
+	case '.':
+		tok = newToken(token.DOT, ch)
 	default:
 		if isLetter(ch) {
 			tok.Literal = l.readIdent()
@@ -88,13 +128,23 @@ func (l *Lexer) NextToken() token.Token {
 		} else if isDigit(ch) {
 			tok.Literal = l.readNumber()
 			tok.Type = token.INT
+			if !l.eof && isLetter(l.ch) {
+				// letters glued to the digits, like 123abc, make one illegal token rather than a number and an identifier
+				tok.Literal += l.readIdent()
+				tok.Type = token.ILLEGAL
+			}
+			return tok
+		} else if ch >= utf8.RuneSelf {
+			// keep multi-byte characters whole so they are reported as a single illegal token
+			tok.Literal = l.readRune()
+			tok.Type = token.ILLEGAL
 			return tok
 		} else {
 			tok = newToken(token.ILLEGAL, ch)
 		}
 	}
 
-	l.pos++
+	l.readChar()
 	return tok
 
 }
@@ -115,43 +165,85 @@ func isDigit(ch byte) bool {
 	return ch >= '0' && ch <= '9'
 }
 
+// readChar advances to the next character of the source, keeping track of its position.
+func (l *Lexer) readChar() {
+	if l.eof {
+		return
+	}
+	if l.ch == '\n' {
+		l.line++
+		l.column = 0
+	}
+
+	ch, err := l.reader.ReadByte()
+	if err != nil {
+		if !errors.Is(err, io.EOF) {
+			l.err = err
+		}
+		l.eof = true
+		l.ch = 0
+		l.column++
+		return
+	}
+	l.ch = ch
+	l.column++
+}
+
+// readIdent reads an identifier, which starts with a letter and may go on with digits, like _1 or x2.
 func (l *Lexer) readIdent() string {
-	startingPos := l.pos
-	for l.pos < len(l.input) && isLetter(l.input[l.pos]) {
-		l.pos++
+	var buf bytes.Buffer
+	for !l.eof && (isLetter(l.ch) || isDigit(l.ch)) {
+		buf.WriteByte(l.ch)
+		l.readChar()
 	}
-	return l.input[startingPos:l.pos]
+	return buf.String()
 }
 
+// readNumber reads the digits of an integer literal along with the underscores grouping them, which the parser checks
+// and strips.
 func (l *Lexer) readNumber() string {
-	startingPos := l.pos
-	for l.pos < len(l.input) && isDigit(l.input[l.pos]) {
-		l.pos++
+	var buf bytes.Buffer
+	for !l.eof && (isDigit(l.ch) || l.ch == '_') {
+		buf.WriteByte(l.ch)
+		l.readChar()
+	}
+	return buf.String()
+}
+
+// readRune reads the UTF-8 encoded character starting at the current character.
+func (l *Lexer) readRune() string {
+	var buf bytes.Buffer
+	buf.WriteByte(l.ch)
+	l.readChar()
+	for !l.eof && !utf8.FullRune(buf.Bytes()) {
+		buf.WriteByte(l.ch)
+		l.readChar()
 	}
-	return l.input[startingPos:l.pos]
+	return buf.String()
 }
 
 func (l *Lexer) readString() string {
-	l.pos++ // move on from starting quote literal
-	startingPos := l.pos
+	l.readChar() // move on from starting quote literal
+	var buf bytes.Buffer
 	// TODO: throw error if string is unbounded and EOF comes before closing quote?
-	for l.pos < len(l.input) && l.input[l.pos] != '"' {
-		l.pos++
+	for !l.eof && l.ch != '"' {
+		buf.WriteByte(l.ch)
+		l.readChar()
 	}
-	return l.input[startingPos:l.pos]
+	return buf.String()
 }
 
 func (l *Lexer) eatComment() {
-	if l.pos < len(l.input) && l.input[l.pos] == '#' {
-		for l.pos < len(l.input) && l.input[l.pos] != '\n' {
-			l.pos++
+	if !l.eof && l.ch == '#' {
+		for !l.eof && l.ch != '\n' {
+			l.readChar()
 		}
 	}
 }
 
 func (l *Lexer) eatWhiteSpace() {
-	for l.pos < len(l.input) && isWhiteSpace(l.input[l.pos]) {
-		l.pos++
+	for !l.eof && isWhiteSpace(l.ch) {
+		l.readChar()
 	}
 }
 
@@ -163,9 +255,9 @@ func isWhiteSpace(ch byte) bool {
 }
 
 func (l *Lexer) peekNextChar() byte {
-	lookupIdx := l.pos + 1
-	if lookupIdx >= len(l.input) {
+	next, err := l.reader.Peek(1)
+	if err != nil {
 		return 0
 	}
-	return l.input[lookupIdx]
+	return next[0]
 }
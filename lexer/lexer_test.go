@@ -1,7 +1,11 @@
 package lexer_test
 
 import (
+	"errors"
+	"io"
+	"strings"
 	"testing"
+	"testing/iotest"
 
 	"github.com/jatin-malik/yal/lexer"
 	"github.com/jatin-malik/yal/token"
@@ -11,7 +15,7 @@ func TestLexer(t *testing.T) {
 
 	t.Run("single line input", func(t *testing.T) {
 
-		input := "+=(){};"
+		input := "+=(){};.=>"
 		l := lexer.New(input)
 
 		tests := []struct {
@@ -25,6 +29,8 @@ func TestLexer(t *testing.T) {
 			{token.LBRACE, "{"},
 			{token.RBRACE, "}"},
 			{token.SEMICOLON, ";"},
+			{token.DOT, "."},
+			{token.ARROW, "=>"},
 			{token.EOF, string(byte(0))},
 		}
 
@@ -40,6 +46,28 @@ func TestLexer(t *testing.T) {
 		}
 	})
 
+	t.Run("digit separators and identifiers with digits", func(t *testing.T) {
+		l := lexer.New("1_000 _1 x2 1__0")
+
+		tests := []struct {
+			expectedTokenType token.TokenType
+			expectedLiteral   string
+		}{
+			{token.INT, "1_000"},
+			{token.IDENT, "_1"},
+			{token.IDENT, "x2"},
+			{token.INT, "1__0"}, // rejected by the parser
+			{token.EOF, string(byte(0))},
+		}
+
+		for _, tt := range tests {
+			tok := l.NextToken()
+			if tok.Type != tt.expectedTokenType || tok.Literal != tt.expectedLiteral {
+				t.Errorf("expected %q %q, got %q %q", tt.expectedTokenType, tt.expectedLiteral, tok.Type, tok.Literal)
+			}
+		}
+	})
+
 	t.Run("multi line input", func(t *testing.T) {
 
 		input := `# Program started
@@ -168,4 +196,218 @@ func TestLexer(t *testing.T) {
 		}
 	})
 
+	t.Run("token positions", func(t *testing.T) {
+		input := "let x = 5;\n# comment\n  \"a\nb\" + x"
+		l := lexer.New(input)
+
+		tests := []struct {
+			expectedTokenType token.TokenType
+			expectedLine      int
+			expectedColumn    int
+		}{
+			{token.LET, 1, 1},
+			{token.IDENT, 1, 5},
+			{token.ASSIGN, 1, 7},
+			{token.INT, 1, 9},
+			{token.SEMICOLON, 1, 10},
+			{token.STRING, 3, 3},
+			{token.PLUS, 4, 4},
+			{token.IDENT, 4, 6},
+			{token.EOF, 4, 7},
+		}
+
+		for _, tt := range tests {
+			tok := l.NextToken()
+			if tok.Type != tt.expectedTokenType {
+				t.Errorf("expected %q, got %q", tt.expectedTokenType, tok.Type)
+			}
+
+			if tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+				t.Errorf("%q: expected position %d:%d, got %d:%d", tok.Literal, tt.expectedLine, tt.expectedColumn,
+					tok.Line, tok.Column)
+			}
+		}
+	})
+
+	t.Run("reader input", func(t *testing.T) {
+		input := `let add = fn(x, y) {
+	x + y; # adds
+};
+let s = "multi
+line";
+if (add(1, 22) != 3) { puts(s) } else { [1, {"a": true}][0] == 1 }`
+
+		expected := []struct {
+			expectedTokenType token.TokenType
+			expectedLiteral   string
+			expectedLine      int
+			expectedColumn    int
+		}{
+			{token.LET, "let", 1, 1},
+			{token.IDENT, "add", 1, 5},
+			{token.ASSIGN, "=", 1, 9},
+			{token.FUNCTION, "fn", 1, 11},
+			{token.LPAREN, "(", 1, 13},
+			{token.IDENT, "x", 1, 14},
+			{token.COMMA, ",", 1, 15},
+			{token.IDENT, "y", 1, 17},
+			{token.RPAREN, ")", 1, 18},
+			{token.LBRACE, "{", 1, 20},
+			{token.IDENT, "x", 2, 2},
+			{token.PLUS, "+", 2, 4},
+			{token.IDENT, "y", 2, 6},
+			{token.SEMICOLON, ";", 2, 7},
+			{token.RBRACE, "}", 3, 1},
+			{token.SEMICOLON, ";", 3, 2},
+			{token.LET, "let", 4, 1},
+			{token.IDENT, "s", 4, 5},
+			{token.ASSIGN, "=", 4, 7},
+			{token.STRING, "multi\nline", 4, 9},
+			{token.SEMICOLON, ";", 5, 6},
+			{token.IF, "if", 6, 1},
+			{token.LPAREN, "(", 6, 4},
+			{token.IDENT, "add", 6, 5},
+			{token.LPAREN, "(", 6, 8},
+			{token.INT, "1", 6, 9},
+			{token.COMMA, ",", 6, 10},
+			{token.INT, "22", 6, 12},
+			{token.RPAREN, ")", 6, 14},
+			{token.NEQ, "!=", 6, 16},
+			{token.INT, "3", 6, 19},
+			{token.RPAREN, ")", 6, 20},
+			{token.LBRACE, "{", 6, 22},
+			{token.IDENT, "puts", 6, 24},
+			{token.LPAREN, "(", 6, 28},
+			{token.IDENT, "s", 6, 29},
+			{token.RPAREN, ")", 6, 30},
+			{token.RBRACE, "}", 6, 32},
+			{token.ELSE, "else", 6, 34},
+			{token.LBRACE, "{", 6, 39},
+			{token.LBRACKET, "[", 6, 41},
+			{token.INT, "1", 6, 42},
+			{token.COMMA, ",", 6, 43},
+			{token.LBRACE, "{", 6, 45},
+			{token.STRING, "a", 6, 46},
+			{token.COLON, ":", 6, 49},
+			{token.TRUE, "true", 6, 51},
+			{token.RBRACE, "}", 6, 55},
+			{token.RBRACKET, "]", 6, 56},
+			{token.LBRACKET, "[", 6, 57},
+			{token.INT, "0", 6, 58},
+			{token.RBRACKET, "]", 6, 59},
+			{token.EQ, "==", 6, 61},
+			{token.INT, "1", 6, 64},
+			{token.RBRACE, "}", 6, 66},
+			{token.EOF, "\x00", 6, 67},
+		}
+
+		readers := map[string]*lexer.Lexer{
+			"reader":          lexer.NewReader(strings.NewReader(input)),
+			"one byte reader": lexer.NewReader(iotest.OneByteReader(strings.NewReader(input))),
+			"chunked reader":  lexer.NewReader(&chunkReader{r: strings.NewReader(input), size: 3}),
+		}
+
+		for name, rl := range readers {
+			t.Run(name, func(t *testing.T) {
+				for _, tt := range expected {
+					tok := rl.NextToken()
+					if tok.Type != tt.expectedTokenType || tok.Literal != tt.expectedLiteral ||
+						tok.Line != tt.expectedLine || tok.Column != tt.expectedColumn {
+						t.Fatalf("expected %s %q at %d:%d, got %s %q at %d:%d", tt.expectedTokenType, tt.expectedLiteral,
+							tt.expectedLine, tt.expectedColumn, tok.Type, tok.Literal, tok.Line, tok.Column)
+					}
+				}
+			})
+		}
+	})
+
+	t.Run("reader error", func(t *testing.T) {
+		readErr := errors.New("boom")
+		l := lexer.NewReader(iotest.TimeoutReader(iotest.OneByteReader(strings.NewReader("let x"))))
+
+		tests := []token.TokenType{token.IDENT, token.EOF}
+		for _, expected := range tests {
+			if tok := l.NextToken(); tok.Type != expected {
+				t.Errorf("expected %q, got %q", expected, tok.Type)
+			}
+		}
+		if !errors.Is(l.Err(), iotest.ErrTimeout) {
+			t.Errorf("expected timeout error, got %v", l.Err())
+		}
+
+		l = lexer.NewReader(iotest.ErrReader(readErr))
+		if tok := l.NextToken(); tok.Type != token.EOF {
+			t.Errorf("expected %q, got %q", token.EOF, tok.Type)
+		}
+		if !errors.Is(l.Err(), readErr) {
+			t.Errorf("expected %v, got %v", readErr, l.Err())
+		}
+	})
+
+	t.Run("letters after digits", func(t *testing.T) {
+		input := `123abc 123 abc 1_0x`
+		l := lexer.New(input)
+
+		tests := []struct {
+			expectedTokenType token.TokenType
+			expectedLiteral   string
+		}{
+			{token.ILLEGAL, "123abc"},
+			{token.INT, "123"},
+			{token.IDENT, "abc"},
+			{token.ILLEGAL, "1_0x"},
+			{token.EOF, string(byte(0))},
+		}
+
+		for _, tt := range tests {
+			tok := l.NextToken()
+			if tok.Type != tt.expectedTokenType {
+				t.Errorf("expected %q, got %q", tt.expectedTokenType, tok.Type)
+			}
+
+			if tok.Literal != tt.expectedLiteral {
+				t.Errorf("expected %q, got %q", tt.expectedLiteral, tok.Literal)
+			}
+		}
+	})
+
+	t.Run("multi-byte characters", func(t *testing.T) {
+		input := `"héllo" é x`
+		l := lexer.New(input)
+
+		tests := []struct {
+			expectedTokenType token.TokenType
+			expectedLiteral   string
+		}{
+			{token.STRING, "héllo"},
+			{token.ILLEGAL, "é"},
+			{token.IDENT, "x"},
+			{token.EOF, string(byte(0))},
+		}
+
+		for _, tt := range tests {
+			tok := l.NextToken()
+			if tok.Type != tt.expectedTokenType {
+				t.Errorf("expected %q, got %q", tt.expectedTokenType, tok.Type)
+			}
+
+			if tok.Literal != tt.expectedLiteral {
+				t.Errorf("expected %q, got %q", tt.expectedLiteral, tok.Literal)
+			}
+		}
+	})
+
+}
+
+// chunkReader returns at most size bytes of r on each read, so reads end in the middle of tokens.
+type chunkReader struct {
+	r    io.Reader
+	size int
+}
+
+func (cr *chunkReader) Read(p []byte) (int, error) {
+	if len(p) > cr.size {
+		p = p[:cr.size]
+	}
+	return cr.r.Read(p)
 }
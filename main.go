@@ -3,26 +3,53 @@ package main
 import (
 	"flag"
 	"fmt"
+	"github.com/jatin-malik/yal/object"
 	"github.com/jatin-malik/yal/processor"
 	"github.com/jatin-malik/yal/repl"
+	"io"
 	"os"
 	"os/user"
 )
 
-var engine = flag.String("engine", "vm", "engine to use ( vm or eval )")
+const defaultEngine = "vm"
+
+var engine = flag.String("engine", defaultEngine, "engine to use ( vm or eval )")
+var check = flag.Bool("check", false, "only parse and compile the file, reporting errors without running it")
+var strict = flag.Bool("strict", false, "fail on the implicit null of an if without else used as a value or a missing hash key")
+var version = flag.Bool("version", false, "print the version and exit")
+var buffered = flag.Bool("buffered", false, "buffer the output of puts and print until flush() or the end of the program, faster but later")
+var maxOutput = flag.Int("max-output", 0, "fail with output limit exceeded once puts and print wrote this many bytes, 0 for no limit")
+var maxDisplay = flag.Int("max-display", repl.MaxDisplay, "elements of an array or hash the REPL shows before truncating a result, 0 for all")
 
 func main() {
 	flag.Parse()
+	processor.Strict = *strict
+	repl.Strict = *strict
+	repl.MaxOutput = *maxOutput
+	repl.MaxDisplay = *maxDisplay
+	object.BufferOutput = *buffered
+	if *maxOutput > 0 {
+		object.Output = object.LimitOutput(os.Stdout, *maxOutput)
+	}
+
+	if *version {
+		printVersion(os.Stdout)
+		return
+	}
 
 	if *engine != "vm" && *engine != "eval" {
-		fmt.Fprintf(os.Stderr, "Usage: %s [-engine vm|eval]", os.Args[0])
+		fmt.Fprintf(os.Stderr, "Usage: %s [-engine vm|eval] [-check] [-strict] [-buffered] [-max-output bytes] [-max-display n] [file [args...]]", os.Args[0])
 		os.Exit(1)
 	}
 
 	args := flag.Args()
 	if len(args) > 0 {
 		filename := args[0]
-		processFile(filename, *engine)
+		if *check {
+			checkFile(filename)
+		} else {
+			processFile(filename, *engine, args[1:])
+		}
 	} else {
 		startREPL(*engine)
 	}
@@ -35,23 +62,41 @@ func startREPL(engine string) {
 	if err != nil {
 		panic(err)
 	}
-	fmt.Printf("Hello %s. Welcome to the yal language REPL. Executing in %s mode\n",
-		currentUser.Username, engine)
+	fmt.Printf("Hello %s. Welcome to the yal language REPL %s. Executing in %s mode\n",
+		currentUser.Username, processor.Version, engine)
 	fmt.Printf("To quit the REPL, say bye.\n")
 
 	// Start the REPL
 	repl.Start(os.Stdin, os.Stdout, engine)
 }
 
-// processFile reads the file and processes it with the provided engine mode
-func processFile(filename string, engine string) {
+// printVersion writes the version the binary was built with and the default engine to w
+func printVersion(w io.Writer) {
+	fmt.Fprintf(w, "yal %s (default engine %s)\n", processor.Version, defaultEngine)
+}
+
+// processFile runs the file with the provided engine mode, passing args on to the program. It exits with status 1 if
+// the file cannot be read or the program fails.
+func processFile(filename string, engine string, args []string) {
 	fmt.Printf("[Processing in %s mode]\n", engine)
-	// Read the file contents
-	data, err := os.ReadFile(filename)
+	obj, err := processor.RunFile(filename, engine, args)
 	if err != nil {
-		fmt.Printf("Error reading file: %s\n", err)
-		return
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	if obj != nil {
+		fmt.Println(obj.Inspect())
 	}
+}
 
-	processor.Process(string(data), engine)
+// checkFile reads the file and reports any parse or compile errors without running it
+func checkFile(filename string) {
+	errs := processor.CheckFile(filename)
+	for _, err := range errs {
+		fmt.Println(err)
+	}
+	if len(errs) != 0 {
+		os.Exit(1)
+	}
 }
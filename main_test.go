@@ -0,0 +1,20 @@
+package main
+
+import (
+	"bytes"
+	"github.com/jatin-malik/yal/processor"
+	"testing"
+)
+
+func TestPrintVersion(t *testing.T) {
+	defer func(previous string) { processor.Version = previous }(processor.Version)
+	processor.Version = "v1.2.3"
+
+	var out bytes.Buffer
+	printVersion(&out)
+
+	expected := "yal v1.2.3 (default engine vm)\n"
+	if out.String() != expected {
+		t.Errorf("expected %q, got %q", expected, out.String())
+	}
+}
@@ -0,0 +1,126 @@
+// Package module resolves imports by splicing the definitions of imported files into the importing program, either
+// directly into the importing scope or wrapped in a module object.
+package module
+
+import (
+	"fmt"
+	"github.com/jatin-malik/yal/ast"
+	"github.com/jatin-malik/yal/lexer"
+	"github.com/jatin-malik/yal/parser"
+	"github.com/jatin-malik/yal/token"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Resolve returns a copy of node, parsed from the file at path, with every import statement replaced by the top-level
+// let statements of the imported file, and every import expression replaced by a call that evaluates those statements
+// in their own scope and returns them as a hash keyed by name. Import paths are relative to the directory of the
+// importing file. An empty path means the source did not come from a file, in which case imports are relative to the
+// working directory. The imported files are parsed with options, which should be those node was parsed with.
+func Resolve(node ast.Node, path string, options ...parser.Option) (ast.Node, error) {
+	r := &resolver{options: options}
+	if path != "" {
+		absPath, err := filepath.Abs(path)
+		if err != nil {
+			return nil, err
+		}
+		r.stack = append(r.stack, absPath)
+	}
+	return r.resolve(node, filepath.Dir(path))
+}
+
+type resolver struct {
+	stack   []string        // absolute paths of the files being resolved, outermost first
+	options []parser.Option // options to parse the imported files with
+}
+
+func (r *resolver) resolve(node ast.Node, dir string) (ast.Node, error) {
+	return ast.Walker(node, func(node ast.Node) (ast.Node, error) {
+		if stmt, ok := node.(*ast.ImportStatement); ok {
+			definitions, err := r.load(stmt.Path.Value, dir)
+			if err != nil {
+				return nil, err
+			}
+			return &ast.BlockStatement{Token: stmt.Token, Statements: definitions}, nil
+		}
+		if exp, ok := node.(*ast.ImportExpression); ok {
+			definitions, err := r.load(exp.Path.Value, dir)
+			if err != nil {
+				return nil, err
+			}
+			return moduleObject(exp.Token, definitions), nil
+		}
+		return node, nil
+	})
+}
+
+// load parses the file at path, resolves its own imports and returns its top-level let statements.
+func (r *resolver) load(path string, dir string) ([]ast.Statement, error) {
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(dir, path)
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, importer := range r.stack {
+		if importer == absPath {
+			var cycle []string
+			for _, file := range append(r.stack[i:], absPath) {
+				cycle = append(cycle, filepath.Base(file))
+			}
+			return nil, fmt.Errorf("import cycle detected: %s", strings.Join(cycle, " -> "))
+		}
+	}
+
+	data, err := os.ReadFile(absPath)
+	if err != nil {
+		return nil, fmt.Errorf("cannot import %q: %w", path, err)
+	}
+
+	p := parser.New(lexer.New(string(data)), r.options...)
+	prg := p.ParseProgram()
+	if len(p.Errors) != 0 {
+		return nil, fmt.Errorf("cannot import %q: %s", path, p.Errors[0])
+	}
+
+	r.stack = append(r.stack, absPath)
+	resolved, err := r.resolve(prg, filepath.Dir(absPath))
+	r.stack = r.stack[:len(r.stack)-1]
+	if err != nil {
+		return nil, err
+	}
+
+	var definitions []ast.Statement
+	for _, stmt := range resolved.(*ast.Program).Statements {
+		switch stmt := stmt.(type) {
+		case *ast.LetStatement:
+			definitions = append(definitions, stmt)
+		case *ast.BlockStatement:
+			// definitions of a nested import
+			definitions = append(definitions, stmt.Statements...)
+		}
+	}
+	return definitions, nil
+}
+
+// moduleObject builds do { <definitions> {"name": name, ...} }, so the definitions stay out of the importing scope. The
+// block is hoisted, so the definitions can refer to each other whatever their order and shadow the importing scope.
+func moduleObject(tok token.Token, definitions []ast.Statement) ast.Expression {
+	synthetic := func(tokenType token.TokenType, literal string) token.Token {
+		return token.Token{Type: tokenType, Literal: literal, Line: tok.Line, Column: tok.Column}
+	}
+
+	members := &ast.HashLiteral{Token: synthetic(token.LBRACE, "{")}
+	for _, stmt := range definitions {
+		name := stmt.(*ast.LetStatement).Name
+		members.Pairs = append(members.Pairs, ast.HashPair{Key: &ast.StringLiteral{Token: name.Token, Value: name.Value}, Value: name})
+	}
+	body := &ast.BlockStatement{
+		Token:      synthetic(token.LBRACE, "{"),
+		Statements: append(definitions, &ast.ExpressionStatement{Token: members.Token, Expr: members}),
+	}
+	return &ast.DoExpression{Token: synthetic(token.DO, "do"), Body: body, Hoisted: true}
+}
@@ -0,0 +1,112 @@
+package module
+
+import (
+	"github.com/jatin-malik/yal/ast"
+	"github.com/jatin-malik/yal/lexer"
+	"github.com/jatin-malik/yal/parser"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// writeFiles creates the files, keyed by name, in a temporary directory and returns its path.
+func writeFiles(t *testing.T, files map[string]string) string {
+	dir := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return dir
+}
+
+func testResolve(t *testing.T, dir, input string) (ast.Node, error) {
+	p := parser.New(lexer.New(input))
+	prg := p.ParseProgram()
+	if len(p.Errors) != 0 {
+		t.Fatalf("parser errors: %v", p.Errors)
+	}
+	return Resolve(prg, filepath.Join(dir, "main.yal"))
+}
+
+func TestResolve(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"math.yal":     `let add = fn(a, b) { a + b }; puts("ignored"); let two = 2;`,
+		"lib/util.yal": `import "../math.yal"; let double = fn(x) { add(x, x) };`,
+		"one.yal":      `let one = 1;`,
+	})
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`import "math.yal"; add(1, two)`, `{ let add = fn (a, b) { ( a + b ) }; let two = 2; }add(1, two)`},
+		{`import "lib/util.yal"; double(2)`, `{ let add = fn (a, b) { ( a + b ) }; let two = 2; let double = fn (x) { add(x, x) }; }double(2)`},
+		{`let f = fn() { import "math.yal"; two }; f()`, `let f = fn () { { let add = fn (a, b) { ( a + b ) }; let two = 2; } two };f()`},
+		{`let m = import("one.yal"); m["one"]`, `let m = do { let one = 1; {"one": one} };m["one"]`},
+		{`import("one.yal")["one"]`, `do { let one = 1; {"one": one} }["one"]`},
+		{`[import("one.yal")]`, `[do { let one = 1; {"one": one} }]`},
+		{`{"m": import("one.yal")}`, `{"m": do { let one = 1; {"one": one} }}`},
+		{`let f = fn() { return import("one.yal"); }; f()`, `let f = fn () { return do { let one = 1; {"one": one} }; };f()`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			resolved, err := testResolve(t, dir, tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if resolved.String() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, resolved.String())
+			}
+		})
+	}
+}
+
+func TestResolveErrors(t *testing.T) {
+	dir := writeFiles(t, map[string]string{
+		"a.yal":      `import "b.yal"; let a = 1;`,
+		"b.yal":      `import "a.yal"; let b = 2;`,
+		"self.yal":   `import "self.yal";`,
+		"broken.yal": `let x 1;`,
+		"loose.yal":  `let a = 1; puts(a) puts(a)`,
+	})
+
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{`import "a.yal";`, "import cycle detected: a.yal -> b.yal -> a.yal"},
+		{`import "self.yal";`, "import cycle detected: self.yal -> self.yal"},
+		{`import "main.yal";`, "import cycle detected: main.yal -> main.yal"},
+		{`import "broken.yal";`, `cannot import "` + filepath.Join(dir, "broken.yal") + `": expected token =, got INT`},
+		{`import "missing.yal";`, `cannot import "` + filepath.Join(dir, "missing.yal") + `": open ` +
+			filepath.Join(dir, "missing.yal") + `: no such file or directory`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			_, err := testResolve(t, dir, tt.input)
+			if err == nil {
+				t.Fatal("expected an error")
+			}
+			if err.Error() != tt.expectedError {
+				t.Errorf("expected error %q, got %q", tt.expectedError, err.Error())
+			}
+		})
+	}
+	// the imported files are parsed with the options given to Resolve
+	prg := parser.New(lexer.New(`import "loose.yal";`)).ParseProgram()
+	if _, err := Resolve(prg, filepath.Join(dir, "main.yal")); err != nil {
+		t.Errorf("unexpected error without options: %v", err)
+	}
+	_, err := Resolve(prg, filepath.Join(dir, "main.yal"), parser.WithStrictSemicolons())
+	expected := `cannot import "` + filepath.Join(dir, "loose.yal") + `": expected token ; after expression, got IDENT`
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
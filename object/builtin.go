@@ -1,9 +1,120 @@
 package object
 
-import "fmt"
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
 
 const BuiltInFunctionObject ObjectType = "BUILTIN_FUNCTION"
 
+// Output is the writer used by builtins that produce output, like puts and print. It defaults to stdout and can be
+// swapped by hosts to capture program output.
+var Output io.Writer = os.Stdout
+
+// BufferOutput makes puts and print write to a buffer in front of Output, which is written out by the flush builtin, by
+// FlushOutput and whenever it fills up. Print heavy programs run faster as they make fewer writes, at the cost of their
+// output showing up late, and not at all if the process is killed before a flush.
+var BufferOutput bool
+
+var (
+	outputBuffer *bufio.Writer
+	bufferTarget io.Writer // the Output outputBuffer writes to
+)
+
+// outputWriter returns the writer output builtins write to.
+func outputWriter() io.Writer {
+	if !BufferOutput {
+		return Output
+	}
+	if outputBuffer == nil || bufferTarget != Output {
+		_ = FlushOutput() // Output was swapped, the pending output still goes to the previous one
+		outputBuffer = bufio.NewWriter(Output)
+		bufferTarget = Output
+	}
+	return outputBuffer
+}
+
+// FlushOutput writes any output buffered while BufferOutput is set.
+func FlushOutput() error {
+	if outputBuffer == nil {
+		return nil
+	}
+	if err := outputBuffer.Flush(); err != nil {
+		outputBuffer = nil // a buffer fails every write after a failed one, the next output starts a new one
+		return err
+	}
+	return nil
+}
+
+// ErrOutputLimit is the error of writes past the cap of a writer returned by LimitOutput.
+var ErrOutputLimit = errors.New("output limit exceeded")
+
+// LimitOutput returns a writer passing at most max bytes on to w, for hosts running untrusted programs that could print
+// without end. A write past the cap keeps what still fits and fails with ErrOutputLimit, which puts and print report as
+// an error.
+func LimitOutput(w io.Writer, max int) io.Writer {
+	return &limitedWriter{w: w, remaining: max}
+}
+
+type limitedWriter struct {
+	w         io.Writer
+	remaining int // bytes that may still be written
+}
+
+func (lw *limitedWriter) Write(p []byte) (int, error) {
+	if len(p) <= lw.remaining {
+		n, err := lw.w.Write(p)
+		lw.remaining -= n
+		return n, err
+	}
+	n, err := lw.w.Write(p[:lw.remaining])
+	lw.remaining -= n
+	if err == nil {
+		err = ErrOutputLimit
+	}
+	return n, err
+}
+
+// writeOutput writes s for the output builtins, reporting a failed write, like one past an output cap, as an error.
+func writeOutput(s string) Object {
+	if _, err := io.WriteString(outputWriter(), s); err != nil {
+		return NewError(err.Error())
+	}
+	return NULL
+}
+
+// LookupEnv and SetEnv back the getenv and setenv builtins. They default to the process environment and can be swapped
+// to run programs against a controlled environment.
+var (
+	LookupEnv = os.LookupEnv
+	SetEnv    = os.Setenv
+)
+
+// Sleep backs the sleep builtin. It defaults to time.Sleep and can be swapped so programs that sleep run without waiting.
+var Sleep = time.Sleep
+
+// sleepSlice is the longest the sleep builtin waits without polling Interrupted, when it is set.
+const sleepSlice = 10 * time.Millisecond
+
+// Interrupted, when set, is polled by the engines on every loop iteration and function call, by the VM on every
+// instruction and by the sleep builtin every sleepSlice. Once it returns true the running program fails with an interrupted error, which lets a caller stop a
+// program that does not end.
+var Interrupted func() bool
+
+// IsInterrupted reports whether Interrupted is set and asks to stop the running program.
+func IsInterrupted() bool {
+	return Interrupted != nil && Interrupted()
+}
+
+// Args holds the command line arguments passed to the running program, returned by the args builtin.
+var Args []string
+
 type BuiltInFunc func(args ...Object) Object
 
 type BuiltinFunction struct {
@@ -19,12 +130,29 @@ func (builtin *BuiltinFunction) Inspect() string {
 }
 
 var BuiltinFunctions = map[string]*BuiltinFunction{
-	"len":   {builtinLen},
-	"first": {builtinFirst},
-	"last":  {builtinLast},
-	"rest":  {builtinRest},
-	"push":  {builtinPush},
-	"puts":  {builtinPuts},
+	"len":       {builtinLen},
+	"first":     {builtinFirst},
+	"last":      {builtinLast},
+	"rest":      {builtinRest},
+	"push":      {builtinPush},
+	"puts":      {builtinPuts},
+	"print":     {builtinPrint},
+	"match":     {builtinMatch},
+	"find_all":  {builtinFindAll},
+	"getenv":    {builtinGetenv},
+	"setenv":    {builtinSetenv},
+	"args":      {builtinArgs},
+	"clone":     {builtinClone},
+	"freeze":    {builtinFreeze},
+	"arity":     {builtinArity},
+	"partial":   {builtinPartial},
+	"compose":   {builtinCompose},
+	"pipe":      {builtinPipe},
+	"deepequal": {builtinDeepEqual},
+	"rjust":     {builtinRjust},
+	"ljust":     {builtinLjust},
+	"flush":     {builtinFlush},
+	"sleep":     {builtinSleep},
 }
 
 var (
@@ -35,9 +163,9 @@ var (
 
 		switch arg := args[0].(type) {
 		case *String:
-			return &Integer{Value: int64(len(arg.Value))}
+			return &Integer{Value: int64(arg.Len())}
 		case *Array:
-			return &Integer{Value: int64(len(arg.Elements))}
+			return &Integer{Value: int64(arg.Len())}
 		default:
 			return NewError(fmt.Sprintf("len(): type %s not supported", arg.Type()))
 		}
@@ -50,8 +178,9 @@ var (
 
 		switch arg := args[0].(type) {
 		case *Array:
-			if len(arg.Elements) > 0 {
-				return arg.Elements[0]
+			if arg.Len() > 0 {
+				first, _ := arg.Get(0)
+				return first
 			}
 			return NewError("empty array")
 		default:
@@ -66,8 +195,9 @@ var (
 
 		switch arg := args[0].(type) {
 		case *Array:
-			if len(arg.Elements) > 0 {
-				return arg.Elements[len(arg.Elements)-1]
+			if arg.Len() > 0 {
+				last, _ := arg.Get(int64(arg.Len() - 1))
+				return last
 			}
 			return NewError("empty array")
 		default:
@@ -82,8 +212,8 @@ var (
 
 		switch arg := args[0].(type) {
 		case *Array:
-			if len(arg.Elements) > 0 {
-				restArray := make([]Object, len(arg.Elements)-1)
+			if arg.Len() > 0 {
+				restArray := make([]Object, arg.Len()-1)
 				copy(restArray, arg.Elements[1:])
 				return &Array{Elements: restArray}
 			}
@@ -100,20 +230,330 @@ var (
 
 		switch arg := args[0].(type) {
 		case *Array:
-			extArray := make([]Object, len(arg.Elements)+1)
-			copy(extArray, arg.Elements)
-			extArray[len(arg.Elements)] = args[1]
-			return &Array{Elements: extArray}
+			// push does not modify its input, but a frozen array is still refused so freeze consistently forbids pushing
+			if arg.Frozen {
+				return NewError(ErrFrozen.Error())
+			}
+			elements := make([]Object, arg.Len(), arg.Len()+1)
+			copy(elements, arg.Elements)
+			extArray := &Array{Elements: elements}
+			extArray.Push(args[1])
+			return extArray
 		default:
 			return NewError(fmt.Sprintf("push(): type %s not supported", arg.Type()))
 		}
 	}
 
 	builtinPuts = func(args ...Object) Object {
+		var out strings.Builder
 		for _, arg := range args {
-			fmt.Print(arg.Inspect())
+			out.WriteString(arg.Inspect())
+		}
+		out.WriteString("\n")
+		return writeOutput(out.String())
+	}
+
+	// builtinPrint writes its arguments joined by sep and followed by end. A trailing hash argument is treated as
+	// options and may override sep (default " ") and end (default "\n").
+	builtinPrint = func(args ...Object) Object {
+		sep, end := " ", "\n"
+		if len(args) > 0 {
+			if options, ok := args[len(args)-1].(*Hash); ok {
+				args = args[:len(args)-1]
+				for key, value := range options.Pairs {
+					str, ok := value.(*String)
+					if key.Type != StringObject || (key.Value != "sep" && key.Value != "end") {
+						return NewError(fmt.Sprintf("print(): unknown option %s", key.Value))
+					}
+					if !ok {
+						return NewError(fmt.Sprintf("print(): option %s must be a STRING, got %s", key.Value, value.Type()))
+					}
+					if key.Value == "sep" {
+						sep = str.Value
+					} else {
+						end = str.Value
+					}
+				}
+			}
+		}
+
+		parts := make([]string, len(args))
+		for i, arg := range args {
+			parts[i] = arg.Inspect()
+		}
+		return writeOutput(strings.Join(parts, sep) + end)
+	}
+
+	builtinMatch = func(args ...Object) Object {
+		re, errObj := compilePattern("match", args)
+		if errObj != nil {
+			return errObj
+		}
+		if re.MatchString(args[0].(*String).Value) {
+			return TRUE
+		}
+		return FALSE
+	}
+
+	builtinFindAll = func(args ...Object) Object {
+		re, errObj := compilePattern("find_all", args)
+		if errObj != nil {
+			return errObj
+		}
+		matches := re.FindAllString(args[0].(*String).Value, -1)
+		elements := make([]Object, len(matches))
+		for i, match := range matches {
+			elements[i] = &String{Value: match}
+		}
+		return &Array{Elements: elements}
+	}
+
+	builtinGetenv = func(args ...Object) Object {
+		if len(args) != 1 {
+			return NewError(fmt.Sprintf("getenv() requires 1 argument. got %d", len(args)))
+		}
+
+		switch arg := args[0].(type) {
+		case *String:
+			if value, ok := LookupEnv(arg.Value); ok {
+				return &String{Value: value}
+			}
+			return NULL
+		default:
+			return NewError(fmt.Sprintf("getenv(): type %s not supported", arg.Type()))
+		}
+	}
+
+	builtinSetenv = func(args ...Object) Object {
+		if len(args) != 2 {
+			return NewError(fmt.Sprintf("setenv() requires 2 arguments. got %d", len(args)))
+		}
+
+		for _, arg := range args {
+			if arg.Type() != StringObject {
+				return NewError(fmt.Sprintf("setenv(): type %s not supported", arg.Type()))
+			}
+		}
+		if err := SetEnv(args[0].(*String).Value, args[1].(*String).Value); err != nil {
+			return NewError(fmt.Sprintf("setenv(): %s", err))
+		}
+		return NULL
+	}
+
+	builtinArgs = func(args ...Object) Object {
+		if len(args) != 0 {
+			return NewError(fmt.Sprintf("args() requires 0 arguments. got %d", len(args)))
+		}
+
+		elements := make([]Object, len(Args))
+		for i, arg := range Args {
+			elements[i] = &String{Value: arg}
+		}
+		return &Array{Elements: elements}
+	}
+
+	builtinClone = func(args ...Object) Object {
+		if len(args) != 1 {
+			return NewError(fmt.Sprintf("clone() requires 1 argument. got %d", len(args)))
+		}
+		return Clone(args[0])
+	}
+
+	builtinFreeze = func(args ...Object) Object {
+		if len(args) != 1 {
+			return NewError(fmt.Sprintf("freeze() requires 1 argument. got %d", len(args)))
+		}
+		switch arg := args[0].(type) {
+		case *Array:
+			arg.Frozen = true
+		case *Hash:
+			arg.Frozen = true
+		}
+		return args[0]
+	}
+
+	builtinArity = func(args ...Object) Object {
+		if len(args) != 1 {
+			return NewError(fmt.Sprintf("arity() requires 1 argument. got %d", len(args)))
+		}
+		arity, err := functionArity(args[0])
+		if err != nil {
+			return err
+		}
+		return &Integer{Value: int64(arity)}
+	}
+
+	builtinPartial = func(args ...Object) Object {
+		if len(args) == 0 {
+			return NewError("partial() requires at least 1 argument. got 0")
+		}
+		switch fn := args[0].(type) {
+		case *Function, *Closure, *BuiltinFunction, *Pipeline:
+			return &Partial{Fn: fn, Args: args[1:]}
+		case *Partial:
+			bound := make([]Object, 0, len(fn.Args)+len(args)-1)
+			bound = append(append(bound, fn.Args...), args[1:]...)
+			return &Partial{Fn: fn.Fn, Args: bound}
+		default:
+			return NewError(fmt.Sprintf("partial(): type %s not supported", fn.Type()))
+		}
+	}
+
+	builtinCompose = func(args ...Object) Object {
+		if len(args) != 2 {
+			return NewError(fmt.Sprintf("compose() requires 2 arguments. got %d", len(args)))
+		}
+		return newPipeline("compose", args[1], args[0])
+	}
+
+	builtinPipe = func(args ...Object) Object {
+		if len(args) != 2 {
+			return NewError(fmt.Sprintf("pipe() requires 2 arguments. got %d", len(args)))
+		}
+		return newPipeline("pipe", args[0], args[1])
+	}
+
+	builtinDeepEqual = func(args ...Object) Object {
+		if len(args) != 2 {
+			return NewError(fmt.Sprintf("deepequal() requires 2 arguments. got %d", len(args)))
+		}
+		if DeepEqual(args[0], args[1]) {
+			return TRUE
+		}
+		return FALSE
+	}
+
+	builtinRjust = func(args ...Object) Object {
+		return justify("rjust", args, true)
+	}
+
+	builtinLjust = func(args ...Object) Object {
+		return justify("ljust", args, false)
+	}
+
+	builtinFlush = func(args ...Object) Object {
+		if len(args) != 0 {
+			return NewError(fmt.Sprintf("flush() requires 0 arguments. got %d", len(args)))
+		}
+		if err := FlushOutput(); err != nil {
+			return NewError(fmt.Sprintf("flush(): %s", err))
+		}
+		return NULL
+	}
+
+	builtinSleep = func(args ...Object) Object {
+		if len(args) != 1 {
+			return NewError(fmt.Sprintf("sleep() requires 1 argument. got %d", len(args)))
+		}
+		ms, ok := args[0].(*Integer)
+		if !ok {
+			return NewError(fmt.Sprintf("sleep(): type %s not supported", args[0].Type()))
+		}
+		if ms.Value < 0 {
+			return NewError(fmt.Sprintf("sleep(): negative duration %d", ms.Value))
+		}
+		d := time.Duration(ms.Value) * time.Millisecond
+		if Interrupted == nil {
+			Sleep(d)
+			return NULL
+		}
+		for d > 0 {
+			if IsInterrupted() {
+				return NewError("interrupted")
+			}
+			slice := min(d, sleepSlice)
+			Sleep(slice)
+			d -= slice
 		}
-		fmt.Println()
 		return NULL
 	}
 )
+
+// justify implements the (value, width) justification builtin called name. The integer or string value is padded with
+// spaces on the left if right is set, else on the right, to at least width characters.
+func justify(name string, args []Object, right bool) Object {
+	if len(args) != 2 {
+		return NewError(fmt.Sprintf("%s() requires 2 arguments. got %d", name, len(args)))
+	}
+
+	var str *String
+	switch arg := args[0].(type) {
+	case *String:
+		str = arg
+	case *Integer:
+		str = &String{Value: arg.Inspect()}
+	default:
+		return NewError(fmt.Sprintf("%s(): type %s not supported", name, arg.Type()))
+	}
+	width, ok := args[1].(*Integer)
+	if !ok {
+		return NewError(fmt.Sprintf("%s(): width must be an integer, got %s", name, args[1].Type()))
+	}
+
+	if width.Value > MaxStringLength {
+		return NewError(fmt.Sprintf("%s(): width %d exceeds %d", name, width.Value, MaxStringLength))
+	}
+
+	padding := strings.Repeat(" ", max(int(width.Value)-str.Len(), 0))
+	if right {
+		return &String{Value: padding + str.Value}
+	}
+	return &String{Value: str.Value + padding}
+}
+
+// newPipeline chains fns in call order for the combinator builtin called name, flattening nested pipelines.
+func newPipeline(name string, fns ...Object) Object {
+	var chain []Object
+	for _, fn := range fns {
+		switch fn := fn.(type) {
+		case *Function, *Closure, *BuiltinFunction, *Partial:
+			chain = append(chain, fn)
+		case *Pipeline:
+			chain = append(chain, fn.Fns...)
+		default:
+			return NewError(fmt.Sprintf("%s(): type %s not supported", name, fn.Type()))
+		}
+	}
+	return &Pipeline{Fns: chain}
+}
+
+// functionArity returns the number of parameters fn declares, or still expects for a partial.
+func functionArity(fn Object) (int, *Error) {
+	switch fn := fn.(type) {
+	case *Function:
+		return len(fn.Parameters), nil
+	case *Closure:
+		return fn.Fn.NumParams, nil
+	case *CompiledFunction:
+		return fn.NumParams, nil
+	case *Partial:
+		arity, err := functionArity(fn.Fn)
+		if err != nil {
+			return 0, err
+		}
+		return arity - len(fn.Args), nil
+	case *Pipeline:
+		return functionArity(fn.Fns[0])
+	default:
+		// builtins are variadic, so they have no arity either
+		return 0, NewError(fmt.Sprintf("arity(): type %s not supported", fn.Type()))
+	}
+}
+
+// compilePattern validates the (string, pattern) arguments of the regex builtin called name and compiles the pattern.
+func compilePattern(name string, args []Object) (*regexp.Regexp, *Error) {
+	if len(args) != 2 {
+		return nil, NewError(fmt.Sprintf("%s() requires 2 arguments. got %d", name, len(args)))
+	}
+	for _, arg := range args {
+		if arg.Type() != StringObject {
+			return nil, NewError(fmt.Sprintf("%s(): type %s not supported", name, arg.Type()))
+		}
+	}
+
+	re, err := regexp.Compile(args[1].(*String).Value)
+	if err != nil {
+		return nil, NewError(fmt.Sprintf("%s(): invalid pattern: %s", name, err))
+	}
+	return re, nil
+}
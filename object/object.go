@@ -2,10 +2,15 @@ package object
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"github.com/jatin-malik/yal/ast"
 	"github.com/jatin-malik/yal/bytecode"
+	"github.com/jatin-malik/yal/token"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 type ObjectType string
@@ -24,6 +29,9 @@ const (
 	ArrayObject            ObjectType = "ARRAY"
 	HashObject             ObjectType = "HASH"
 	QuoteObject            ObjectType = "QUOTE"
+	PatternObject          ObjectType = "PATTERN"
+	PartialObject          ObjectType = "PARTIAL"
+	PipelineObject         ObjectType = "PIPELINE"
 )
 
 var (
@@ -78,6 +86,44 @@ func (string *String) HashKey() HashKey {
 	return HashKey{Type: string.Type(), Value: string.Inspect()}
 }
 
+// Len returns the number of characters (runes) in the string.
+func (string *String) Len() int {
+	return utf8.RuneCountInString(string.Value)
+}
+
+// Get returns the character (rune) at index as a string. It returns an error if index is out of bounds.
+func (string *String) Get(index int64) (Object, error) {
+	if index >= 0 {
+		var i int64
+		for _, r := range string.Value {
+			if i == index {
+				var buf strings.Builder
+				buf.WriteRune(r)
+				return &String{Value: buf.String()}, nil
+			}
+			i++
+		}
+	}
+	return nil, fmt.Errorf("index %d out of bounds for string length %d", index, string.Len())
+}
+
+// MaxStringLength is the length in bytes of the longest string Repeat and the justification builtins build, so a huge
+// count or width fails with an error instead of exhausting memory.
+const MaxStringLength = 1 << 27
+
+// Repeat returns the string repeated count times. A zero or negative count yields the empty string. It returns an
+// error if the result would be longer than MaxStringLength.
+func (string *String) Repeat(count int64) (*String, error) {
+	if count <= 0 || len(string.Value) == 0 {
+		return &String{}, nil
+	}
+	if count > int64(MaxStringLength/len(string.Value)) {
+		return nil, fmt.Errorf("string too long: repeating %d bytes %d times exceeds %d bytes", len(string.Value), count,
+			MaxStringLength)
+	}
+	return &String{Value: strings.Repeat(string.Value, int(count))}, nil
+}
+
 type Boolean struct {
 	Value bool
 }
@@ -111,8 +157,12 @@ func (quote *Quote) Inspect() string {
 	return out.String()
 }
 
+// ErrFrozen is returned when modifying an array or hash marked frozen.
+var ErrFrozen = errors.New("cannot modify frozen value")
+
 type Array struct {
 	Elements []Object
+	Frozen   bool // set by freeze, rejects any modification
 }
 
 func (array *Array) Type() ObjectType {
@@ -131,8 +181,98 @@ func (array *Array) Inspect() string {
 	return out.String()
 }
 
+// Len returns the number of elements in the array.
+func (array *Array) Len() int {
+	return len(array.Elements)
+}
+
+// Get returns the element at index. It returns an error if index is out of bounds.
+func (array *Array) Get(index int64) (Object, error) {
+	if err := array.checkBounds(index); err != nil {
+		return nil, err
+	}
+	return array.Elements[index], nil
+}
+
+// Set replaces the element at index with value. It returns an error if index is out of bounds or the array is frozen.
+func (array *Array) Set(index int64, value Object) error {
+	if array.Frozen {
+		return ErrFrozen
+	}
+	if err := array.checkBounds(index); err != nil {
+		return err
+	}
+	array.Elements[index] = value
+	return nil
+}
+
+// Push appends value to the end of the array. It returns an error if the array is frozen.
+func (array *Array) Push(value Object) error {
+	if array.Frozen {
+		return ErrFrozen
+	}
+	array.Elements = append(array.Elements, value)
+	return nil
+}
+
+func (array *Array) checkBounds(index int64) error {
+	if index < 0 || index >= int64(len(array.Elements)) {
+		return fmt.Errorf("index %d out of bounds for arr length %d", index, len(array.Elements))
+	}
+	return nil
+}
+
 type Hash struct {
-	Pairs map[HashKey]Object
+	Pairs  map[HashKey]Object
+	Frozen bool // set by freeze, rejects any modification
+}
+
+// NewHash returns an empty hash.
+func NewHash() *Hash {
+	return &Hash{Pairs: make(map[HashKey]Object)}
+}
+
+// Set stores value under key. It returns an error if key is not hashable or the hash is frozen.
+func (hash *Hash) Set(key, value Object) error {
+	if hash.Frozen {
+		return ErrFrozen
+	}
+	if err := CheckKey(key); err != nil {
+		return err
+	}
+	hash.Pairs[key.(Hashable).HashKey()] = value
+	return nil
+}
+
+// Get returns the value stored under key and whether it was present. A key that is not hashable is never present.
+func (hash *Hash) Get(key Object) (Object, bool) {
+	hashable, ok := key.(Hashable)
+	if !ok {
+		return nil, false
+	}
+	value, ok := hash.Pairs[hashable.HashKey()]
+	return value, ok
+}
+
+// CheckKey returns the error Set reports for key if it cannot be used as a hash key, nil otherwise. Closures and
+// compiled functions are named FUNCTION, so both engines report a function key the same way.
+func CheckKey(key Object) error {
+	if _, ok := key.(Hashable); ok {
+		return nil
+	}
+	keyType := key.Type()
+	if keyType == ClosureObject || keyType == CompiledFunctionObject {
+		keyType = FunctionObject
+	}
+	return fmt.Errorf("key type %s is not hashable", keyType)
+}
+
+// KeyString renders key the way it would be written in a hash literal, for error messages.
+func KeyString(key Object) string {
+	if str, ok := key.(*String); ok {
+		return fmt.Sprintf("%q", str.Value)
+	}
+	return key.Inspect()
 }
 
 func (hash *Hash) Type() ObjectType {
@@ -156,8 +296,133 @@ func (hash *Hash) Inspect() string {
 	return out.String()
 }
 
+// InspectTruncated is Inspect for display, showing at most max elements of each array and pairs of each hash, nested
+// ones included. A longer array shows its first elements and its last one around an ellipsis, a longer hash some of its
+// pairs, both followed by their length. A max of zero or less shows everything, like Inspect.
+func InspectTruncated(obj Object, max int) string {
+	if max <= 0 {
+		return obj.Inspect()
+	}
+	switch obj := obj.(type) {
+	case *Array:
+		if len(obj.Elements) <= max {
+			elements := make([]string, 0, len(obj.Elements))
+			for _, e := range obj.Elements {
+				elements = append(elements, InspectTruncated(e, max))
+			}
+			return "[" + strings.Join(elements, ", ") + "]"
+		}
+		elements := make([]string, 0, max+1)
+		for _, e := range obj.Elements[:max-1] {
+			elements = append(elements, InspectTruncated(e, max))
+		}
+		elements = append(elements, "...", InspectTruncated(obj.Elements[len(obj.Elements)-1], max))
+		return fmt.Sprintf("[%s] (len %d)", strings.Join(elements, ", "), len(obj.Elements))
+	case *Hash:
+		pairs := make([]string, 0, max+1)
+		for _, k := range sortedKeys(obj.Pairs) {
+			if len(pairs) == max {
+				pairs = append(pairs, "...")
+				break
+			}
+			pairs = append(pairs, k.Value+":"+InspectTruncated(obj.Pairs[k], max))
+		}
+		if len(obj.Pairs) <= max {
+			return "{" + strings.Join(pairs, ", ") + "}"
+		}
+		return fmt.Sprintf("{%s} (len %d)", strings.Join(pairs, ", "), len(obj.Pairs))
+	default:
+		return obj.Inspect()
+	}
+}
+
+// sortedKeys returns the keys of pairs grouped by type, integers in numeric order and the others by their value, so a
+// truncated hash always shows the same pairs.
+func sortedKeys(pairs map[HashKey]Object) []HashKey {
+	keys := make([]HashKey, 0, len(pairs))
+	for k := range pairs {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		if a.Type == IntegerObject {
+			x, _ := strconv.ParseInt(a.Value, 10, 64)
+			y, _ := strconv.ParseInt(b.Value, 10, 64)
+			return x < y
+		}
+		return a.Value < b.Value
+	})
+	return keys
+}
+
+// Clone returns a deep copy of arrays and hashes, so that modifying the copy leaves obj untouched. The copy is never
+// frozen. Other objects are immutable and returned as is.
+func Clone(obj Object) Object {
+	switch obj := obj.(type) {
+	case *Array:
+		elements := make([]Object, len(obj.Elements))
+		for i, e := range obj.Elements {
+			elements[i] = Clone(e)
+		}
+		return &Array{Elements: elements}
+	case *Hash:
+		hash := &Hash{Pairs: make(map[HashKey]Object, len(obj.Pairs))}
+		for k, v := range obj.Pairs {
+			hash.Pairs[k] = Clone(v)
+		}
+		return hash
+	default:
+		return obj
+	}
+}
+
+// DeepEqual reports whether a and b are structurally equal. Arrays are equal when their elements are pairwise equal and
+// hashes when they hold equal values under the same keys. Objects of different types are never equal and functions
+// are only equal to themselves.
+func DeepEqual(a, b Object) bool {
+	if a.Type() != b.Type() {
+		return false
+	}
+
+	switch a := a.(type) {
+	case *Integer:
+		return a.Value == b.(*Integer).Value
+	case *String:
+		return a.Value == b.(*String).Value
+	case *Array:
+		b := b.(*Array)
+		if len(a.Elements) != len(b.Elements) {
+			return false
+		}
+		for i := range a.Elements {
+			if !DeepEqual(a.Elements[i], b.Elements[i]) {
+				return false
+			}
+		}
+		return true
+	case *Hash:
+		b := b.(*Hash)
+		if len(a.Pairs) != len(b.Pairs) {
+			return false
+		}
+		for k, v := range a.Pairs {
+			other, ok := b.Pairs[k]
+			if !ok || !DeepEqual(v, other) {
+				return false
+			}
+		}
+		return true
+	default:
+		return a == b // booleans and null are singletons
+	}
+}
+
 type CompiledFunction struct {
 	Instructions bytecode.Instructions
+	SourceMap    bytecode.SourceMap
 	NumLocals    int
 	NumParams    int
 }
@@ -231,6 +496,43 @@ func (macro *Macro) Inspect() string {
 	return out.String()
 }
 
+// Partial is a function with its leading arguments already bound, created by the partial builtin. Calling it calls Fn
+// with Args followed by the call arguments.
+type Partial struct {
+	Fn   Object // never a *Partial, nested partials are flattened
+	Args []Object
+}
+
+func (partial *Partial) Type() ObjectType {
+	return PartialObject
+}
+
+func (partial *Partial) Inspect() string {
+	var args []string
+	for _, arg := range partial.Args {
+		args = append(args, arg.Inspect())
+	}
+	return fmt.Sprintf("partial(%s, %s)", partial.Fn.Inspect(), strings.Join(args, ", "))
+}
+
+// Pipeline is a chain of single argument functions, created by the compose and pipe builtins. Calling it calls the
+// first of Fns with the call arguments and every following one with the result of the previous.
+type Pipeline struct {
+	Fns []Object
+}
+
+func (pipeline *Pipeline) Type() ObjectType {
+	return PipelineObject
+}
+
+func (pipeline *Pipeline) Inspect() string {
+	var fns []string
+	for _, fn := range pipeline.Fns {
+		fns = append(fns, fn.Inspect())
+	}
+	return fmt.Sprintf("pipe(%s)", strings.Join(fns, ", "))
+}
+
 // Null is a billion-dollar mistake but sure, why not!
 type Null struct {
 }
@@ -243,6 +545,11 @@ func (null *Null) Inspect() string {
 	return "null"
 }
 
+// HashKey makes null usable as a hash key, for scripts that want a sentinel key.
+func (null *Null) HashKey() HashKey {
+	return HashKey{Type: null.Type(), Value: null.Inspect()}
+}
+
 type ReturnValue struct {
 	Value Object
 }
@@ -255,7 +562,10 @@ func (returnValue *ReturnValue) Inspect() string {
 	return returnValue.Value.Inspect()
 }
 
+// Error is the value a failed evaluation produces. Token locates the node that failed, once the evaluator knows it,
+// and has line 0 before.
 type Error struct {
+	Token   token.Token
 	Message string
 }
 
@@ -278,18 +588,41 @@ func NewEnvironment(outer *Environment) *Environment {
 }
 
 func (env *Environment) Get(name string) Object {
-	if obj, ok := env.store[name]; ok {
+	if obj, ok := env.lookup(name); ok {
 		return obj
+	}
+	msg := fmt.Sprintf("Undefined variable %q", name)
+	if suggestion, ok := ClosestName(name, env.names()); ok {
+		msg += fmt.Sprintf(", did you mean '%s'?", suggestion)
+	}
+	return NewError(msg)
+}
+
+func (env *Environment) lookup(name string) (Object, bool) {
+	if obj, ok := env.store[name]; ok {
+		return obj, true
 	} else {
 		if env.outer != nil {
-			return env.outer.Get(name)
+			return env.outer.lookup(name)
 		} else if fn, ok := BuiltinFunctions[name]; ok {
-			return fn
-		} else {
-			msg := fmt.Sprintf("Undefined variable %q", name)
-			return NewError(msg)
+			return fn, true
+		}
+		return nil, false
+	}
+}
+
+// names returns every name visible from this environment, including builtins.
+func (env *Environment) names() []string {
+	var names []string
+	for e := env; e != nil; e = e.outer {
+		for name := range e.store {
+			names = append(names, name)
 		}
 	}
+	for name := range BuiltinFunctions {
+		names = append(names, name)
+	}
+	return names
 }
 
 func (env *Environment) Set(name string, value Object) {
@@ -0,0 +1,334 @@
+package object
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestHashSetGet(t *testing.T) {
+	hash := NewHash()
+
+	if err := hash.Set(&String{Value: "name"}, &String{Value: "yal"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := hash.Set(&Integer{Value: 1}, TRUE); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if err := hash.Set(TRUE, &Integer{Value: 1}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	tests := []struct {
+		key      Object
+		expected string
+		found    bool
+	}{
+		{&String{Value: "name"}, "yal", true},
+		{&Integer{Value: 1}, "true", true},
+		{TRUE, "1", true},
+		{&String{Value: "1"}, "", false}, // same value, different type
+		{FALSE, "", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key.Inspect(), func(t *testing.T) {
+			val, ok := hash.Get(tt.key)
+			if ok != tt.found {
+				t.Fatalf("expected found=%t, got %t", tt.found, ok)
+			}
+			if ok && val.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, val.Inspect())
+			}
+		})
+	}
+
+	// Overwriting an existing key replaces its value
+	_ = hash.Set(&String{Value: "name"}, &String{Value: "lang"})
+	if val, _ := hash.Get(&String{Value: "name"}); val.Inspect() != "lang" {
+		t.Errorf("expected lang, got %s", val.Inspect())
+	}
+	if len(hash.Pairs) != 3 {
+		t.Errorf("expected 3 pairs, got %d", len(hash.Pairs))
+	}
+}
+
+func TestHashNullKey(t *testing.T) {
+	hash := NewHash()
+	if err := hash.Set(NULL, &String{Value: "x"}); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	_ = hash.Set(&String{Value: "null"}, &String{Value: "y"})
+
+	if val, ok := hash.Get(NULL); !ok || val.Inspect() != "x" {
+		t.Errorf("expected x, got %v (found=%t)", val, ok)
+	}
+	if len(hash.Pairs) != 2 {
+		t.Errorf("expected null and \"null\" to be different keys, got %d pairs", len(hash.Pairs))
+	}
+}
+
+func TestHashUnhashableKey(t *testing.T) {
+	tests := []struct {
+		key      Object
+		expected string
+	}{
+		{&Array{}, "key type ARRAY is not hashable"},
+		{&Hash{}, "key type HASH is not hashable"},
+		{&Function{}, "key type FUNCTION is not hashable"},
+		{&CompiledFunction{}, "key type FUNCTION is not hashable"},
+		{&Closure{}, "key type FUNCTION is not hashable"},
+		{&Macro{}, "key type MACRO is not hashable"},
+		{&Quote{}, "key type QUOTE is not hashable"},
+	}
+
+	for _, tt := range tests {
+		t.Run(string(tt.key.Type()), func(t *testing.T) {
+			hash := NewHash()
+			if err := hash.Set(tt.key, TRUE); err == nil || err.Error() != tt.expected {
+				t.Errorf("expected %q, got %v", tt.expected, err)
+			}
+			if err := CheckKey(tt.key); err == nil || err.Error() != tt.expected {
+				t.Errorf("expected %q, got %v", tt.expected, err)
+			}
+			if _, ok := hash.Get(tt.key); ok {
+				t.Errorf("expected an unhashable key to be reported as not found")
+			}
+			if len(hash.Pairs) != 0 {
+				t.Errorf("expected empty hash, got %d pairs", len(hash.Pairs))
+			}
+		})
+	}
+}
+
+func TestArrayGetSet(t *testing.T) {
+	array := &Array{Elements: []Object{&Integer{Value: 1}, &Integer{Value: 2}, &Integer{Value: 3}}}
+
+	tests := []struct {
+		index         int64
+		expected      string
+		expectedError string
+	}{
+		{0, "1", ""},
+		{2, "3", ""},
+		{3, "", "index 3 out of bounds for arr length 3"},
+		{-1, "", "index -1 out of bounds for arr length 3"},
+		{-4, "", "index -4 out of bounds for arr length 3"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("Get(%d)", tt.index), func(t *testing.T) {
+			val, err := array.Get(tt.index)
+			if tt.expectedError != "" {
+				if err == nil || err.Error() != tt.expectedError {
+					t.Errorf("expected error %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if val.Inspect() != tt.expected {
+				t.Errorf("expected %s, got %s", tt.expected, val.Inspect())
+			}
+		})
+
+		t.Run(fmt.Sprintf("Set(%d)", tt.index), func(t *testing.T) {
+			err := array.Set(tt.index, &String{Value: "x"})
+			if tt.expectedError != "" {
+				if err == nil || err.Error() != tt.expectedError {
+					t.Errorf("expected error %q, got %v", tt.expectedError, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if val, _ := array.Get(tt.index); val.Inspect() != "x" {
+				t.Errorf("expected x, got %s", val.Inspect())
+			}
+		})
+	}
+}
+
+func TestArrayPushLen(t *testing.T) {
+	array := &Array{}
+	if array.Len() != 0 {
+		t.Fatalf("expected empty array, got length %d", array.Len())
+	}
+
+	array.Push(&Integer{Value: 1})
+	array.Push(TRUE)
+	if array.Len() != 2 {
+		t.Fatalf("expected length 2, got %d", array.Len())
+	}
+	if array.Inspect() != "[1, true]" {
+		t.Errorf("expected [1, true], got %s", array.Inspect())
+	}
+}
+
+func TestClone(t *testing.T) {
+	inner := &Array{Elements: []Object{&Integer{Value: 2}}}
+	hash := NewHash()
+	_ = hash.Set(&String{Value: "inner"}, inner)
+	original := &Array{Elements: []Object{&Integer{Value: 1}, inner, hash}}
+
+	clone := Clone(original).(*Array)
+	if clone.Inspect() != original.Inspect() {
+		t.Fatalf("expected %s, got %s", original.Inspect(), clone.Inspect())
+	}
+
+	// Mutate every level of the clone
+	_ = clone.Set(0, &Integer{Value: 10})
+	clone.Push(&Integer{Value: 4})
+	_ = clone.Elements[1].(*Array).Set(0, &Integer{Value: 20})
+	_ = clone.Elements[2].(*Hash).Set(&String{Value: "inner"}, NULL)
+
+	if original.Inspect() != "[1, [2], {inner:[2]}]" {
+		t.Errorf("expected the original to be unchanged, got %s", original.Inspect())
+	}
+
+	// Immutable objects are shared
+	str := &String{Value: "yal"}
+	if Clone(str) != str {
+		t.Errorf("expected strings to be returned as is")
+	}
+}
+
+func TestFrozen(t *testing.T) {
+	array := &Array{Elements: []Object{&Integer{Value: 1}}, Frozen: true}
+	if err := array.Set(0, TRUE); err != ErrFrozen {
+		t.Errorf("expected ErrFrozen, got %v", err)
+	}
+	if err := array.Push(TRUE); err != ErrFrozen {
+		t.Errorf("expected ErrFrozen, got %v", err)
+	}
+	if array.Inspect() != "[1]" {
+		t.Errorf("expected the frozen array to be unchanged, got %s", array.Inspect())
+	}
+
+	hash := NewHash()
+	hash.Frozen = true
+	if err := hash.Set(&String{Value: "a"}, TRUE); err != ErrFrozen {
+		t.Errorf("expected ErrFrozen, got %v", err)
+	}
+	if len(hash.Pairs) != 0 {
+		t.Errorf("expected the frozen hash to be unchanged, got %d pairs", len(hash.Pairs))
+	}
+
+	if Clone(array).(*Array).Frozen {
+		t.Errorf("expected a clone of a frozen array to be mutable")
+	}
+}
+
+func TestDeepEqual(t *testing.T) {
+	nested := func(last int64) Object {
+		hash := NewHash()
+		_ = hash.Set(&String{Value: "list"}, &Array{Elements: []Object{&Integer{Value: 1}, &Integer{Value: last}}})
+		return &Array{Elements: []Object{hash, TRUE, NULL}}
+	}
+
+	tests := []struct {
+		a, b     Object
+		expected bool
+	}{
+		{nested(2), nested(2), true},
+		{nested(2), nested(3), false},
+		{&Integer{Value: 1}, &String{Value: "1"}, false},
+		{&Array{}, NewHash(), false},
+		{NULL, NULL, true},
+		{TRUE, FALSE, false},
+	}
+
+	for _, tt := range tests {
+		if got := DeepEqual(tt.a, tt.b); got != tt.expected {
+			t.Errorf("DeepEqual(%s, %s): expected %t, got %t", tt.a.Inspect(), tt.b.Inspect(), tt.expected, got)
+		}
+	}
+}
+
+func TestInspectTruncated(t *testing.T) {
+	ints := func(n int) *Array {
+		array := &Array{}
+		for i := 1; i <= n; i++ {
+			array.Elements = append(array.Elements, &Integer{Value: int64(i)})
+		}
+		return array
+	}
+	hash := NewHash()
+	_ = hash.Set(&String{Value: "list"}, ints(5))
+
+	tests := []struct {
+		obj      Object
+		max      int
+		expected string
+	}{
+		{ints(100000), 3, "[1, 2, ..., 100000] (len 100000)"},
+		{ints(3), 3, "[1, 2, 3]"},
+		{ints(4), 1, "[..., 4] (len 4)"},
+		{&Array{Elements: []Object{ints(2), ints(4)}}, 2, "[[1, 2], [1, ..., 4] (len 4)]"},
+		{hash, 3, "{list:[1, 2, ..., 5] (len 5)}"},
+		{ints(5), 0, "[1, 2, 3, 4, 5]"},
+		{&String{Value: "yal"}, 1, "yal"},
+	}
+
+	for _, tt := range tests {
+		if got := InspectTruncated(tt.obj, tt.max); got != tt.expected {
+			t.Errorf("InspectTruncated(%d): expected %q, got %q", tt.max, tt.expected, got)
+		}
+	}
+
+	if full := ints(100000).Inspect(); !strings.HasSuffix(full, ", 99999, 100000]") {
+		t.Errorf("expected Inspect to show every element, got %q", full[len(full)-30:])
+	}
+
+	big := NewHash()
+	for i := int64(0); i < 10; i++ {
+		_ = big.Set(&Integer{Value: i}, TRUE)
+	}
+	_ = big.Set(&String{Value: "a"}, FALSE)
+	_ = big.Set(&Integer{Value: -3}, FALSE)
+	for i := 0; i < 20; i++ { // map order changes between iterations, the pairs shown must not
+		expected := "{-3:false, 0:true, 1:true, 2:true, ...} (len 12)"
+		if truncated := InspectTruncated(big, 4); truncated != expected {
+			t.Fatalf("expected %q, got %q", expected, truncated)
+		}
+	}
+	if full := big.Inspect(); strings.Count(full, ":true") != 10 || strings.Count(full, ":false") != 2 {
+		t.Errorf("expected Inspect to show every pair, got %q", full)
+	}
+}
+
+func TestBufferedOutput(t *testing.T) {
+	defer func(previous io.Writer) { Output, BufferOutput = previous, false }(Output)
+	var out bytes.Buffer
+	Output = &out
+	BufferOutput = true
+
+	BuiltinFunctions["puts"].Fn(&String{Value: "buffered"})
+	if out.Len() != 0 {
+		t.Fatalf("expected no output before flush, got %q", out.String())
+	}
+
+	if result := BuiltinFunctions["flush"].Fn(); result != NULL {
+		t.Fatalf("expected null, got %s", result.Inspect())
+	}
+	if out.String() != "buffered\n" {
+		t.Errorf("expected %q after flush, got %q", "buffered\n", out.String())
+	}
+
+	// swapping Output writes what is pending to the previous writer
+	BuiltinFunctions["print"].Fn(&String{Value: "pending"})
+	var other bytes.Buffer
+	Output = &other
+	BuiltinFunctions["print"].Fn(&String{Value: "next"})
+	if out.String() != "buffered\npending\n" || other.Len() != 0 {
+		t.Errorf("expected the pending output in the previous writer, got %q and %q", out.String(), other.String())
+	}
+	_ = FlushOutput()
+	if other.String() != "next\n" {
+		t.Errorf("expected %q, got %q", "next\n", other.String())
+	}
+}
@@ -0,0 +1,114 @@
+package object
+
+import (
+	"github.com/jatin-malik/yal/ast"
+	"sort"
+)
+
+// Pattern carries a match arm pattern through the constant pool to the VM, along with the names it binds.
+type Pattern struct {
+	Node  ast.Expression
+	Names []string // PatternNames(Node), the order in which the VM pushes bound values
+}
+
+func (pattern *Pattern) Type() ObjectType {
+	return PatternObject
+}
+
+func (pattern *Pattern) Inspect() string {
+	return "pattern(" + pattern.Node.String() + ")"
+}
+
+// MatchPattern reports whether value has the shape described by pattern, storing the values of the names it binds
+// into bindings. bindings may be partially filled when the match fails.
+func MatchPattern(pattern ast.Expression, value Object, bindings map[string]Object) bool {
+	switch pattern := pattern.(type) {
+	case *ast.IntegerLiteral:
+		integer, ok := value.(*Integer)
+		return ok && integer.Value == pattern.Value
+	case *ast.PrefixExpression:
+		// only negative integer literals are valid prefix patterns
+		integer, ok := value.(*Integer)
+		return ok && integer.Value == -pattern.Right.(*ast.IntegerLiteral).Value
+	case *ast.StringLiteral:
+		str, ok := value.(*String)
+		return ok && str.Value == pattern.Value
+	case *ast.BooleanLiteral:
+		boolean, ok := value.(*Boolean)
+		return ok && boolean.Value == pattern.Value
+	case *ast.Identifier:
+		if pattern.Value != "_" {
+			bindings[pattern.Value] = value
+		}
+		return true
+	case *ast.ArrayLiteral:
+		array, ok := value.(*Array)
+		if !ok || array.Len() != len(pattern.Elements) {
+			return false
+		}
+		for i, element := range pattern.Elements {
+			if !MatchPattern(element, array.Elements[i], bindings) {
+				return false
+			}
+		}
+		return true
+	case *ast.HashLiteral:
+		hash, ok := value.(*Hash)
+		if !ok {
+			return false
+		}
+		for _, pair := range pattern.Pairs {
+			member, found := hash.Get(patternKey(pair.Key))
+			if !found || !MatchPattern(pair.Value, member, bindings) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// patternKey returns the hash key named by a hash pattern key. A bare identifier names a string key.
+func patternKey(key ast.Expression) Object {
+	switch key := key.(type) {
+	case *ast.Identifier:
+		return &String{Value: key.Value}
+	case *ast.StringLiteral:
+		return &String{Value: key.Value}
+	case *ast.IntegerLiteral:
+		return &Integer{Value: key.Value}
+	case *ast.BooleanLiteral:
+		if key.Value {
+			return TRUE
+		}
+		return FALSE
+	default:
+		return NULL
+	}
+}
+
+// PatternNames returns the sorted names bound by pattern.
+func PatternNames(pattern ast.Expression) []string {
+	var names []string
+	var collect func(ast.Expression)
+	collect = func(pattern ast.Expression) {
+		switch pattern := pattern.(type) {
+		case *ast.Identifier:
+			if pattern.Value != "_" {
+				names = append(names, pattern.Value)
+			}
+		case *ast.ArrayLiteral:
+			for _, element := range pattern.Elements {
+				collect(element)
+			}
+		case *ast.HashLiteral:
+			for _, pair := range pattern.Pairs {
+				collect(pair.Value)
+			}
+		}
+	}
+	collect(pattern)
+	sort.Strings(names)
+	return names
+}
@@ -1,5 +1,7 @@
 package object
 
+import "sort"
+
 func IsErrorValue(obj Object) bool {
 	if _, ok := obj.(*Error); ok {
 		return true
@@ -26,3 +28,43 @@ func IsTruthy(obj Object) bool {
 		return true
 	}
 }
+
+// ClosestName returns the candidate closest to name by edit distance, if one is close enough to be a likely typo.
+// Ties are broken alphabetically so suggestions are deterministic.
+func ClosestName(name string, candidates []string) (string, bool) {
+	maxDistance := len(name) / 3
+	sort.Strings(candidates)
+
+	best, bestDistance := "", maxDistance+1
+	for _, candidate := range candidates {
+		if candidate == name {
+			continue
+		}
+		if distance := levenshtein(name, candidate); distance < bestDistance {
+			best, bestDistance = candidate, distance
+		}
+	}
+	return best, best != ""
+}
+
+// levenshtein computes the minimum number of single character edits needed to turn a into b.
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
@@ -1,11 +1,13 @@
 package parser
 
 import (
+	"errors"
 	"fmt"
 	"github.com/jatin-malik/yal/ast"
 	"github.com/jatin-malik/yal/lexer"
 	"github.com/jatin-malik/yal/token"
 	"strconv"
+	"strings"
 )
 
 type prefixParsingFunction func() ast.Expression
@@ -16,15 +18,33 @@ type Parser struct {
 	curToken      token.Token
 	peekToken     token.Token
 	Errors        []string
+	ErrorTokens   []token.Token // ErrorTokens[i] is the token at which Errors[i] was reported
 	prefixParsers map[token.TokenType]prefixParsingFunction
 	infixParsers  map[token.TokenType]infixParsingFunction
+
+	strictSemicolons bool // require a semicolon after expression statements, see WithStrictSemicolons
+}
+
+type Option func(*Parser)
+
+// WithStrictSemicolons makes a missing semicolon after an expression statement an error, as it is after let and return
+// statements. The last statement of a program or block and a statement ending with a block, like an if, still need
+// none. Without it semicolons after expression statements are optional, for convenience in the REPL.
+func WithStrictSemicolons() Option {
+	return func(p *Parser) {
+		p.strictSemicolons = true
+	}
 }
 
-func New(lexer *lexer.Lexer) *Parser {
+func New(lexer *lexer.Lexer, options ...Option) *Parser {
 	parser := &Parser{lexer: lexer}
+	for _, option := range options {
+		option(parser)
+	}
 	parser.curToken = lexer.NextToken()
 	parser.peekToken = lexer.NextToken()
 	parser.Errors = []string{}
+	parser.ErrorTokens = []token.Token{}
 	parser.prefixParsers = make(map[token.TokenType]prefixParsingFunction)
 	parser.infixParsers = make(map[token.TokenType]infixParsingFunction)
 
@@ -40,9 +60,11 @@ func New(lexer *lexer.Lexer) *Parser {
 	parser.registerPrefix(token.FUNCTION, parser.parseFunctionLiteral)
 	parser.registerPrefix(token.MACRO, parser.parseMacroLiteral)
 	parser.registerPrefix(token.IF, parser.parseIfElseConditional)
+	parser.registerPrefix(token.DO, parser.parseDoExpression)
 	parser.registerPrefix(token.STRING, parser.parseStringLiteral)
 	parser.registerPrefix(token.LBRACKET, parser.parseArrayLiteral)
 	parser.registerPrefix(token.LBRACE, parser.parseHashLiteral)
+	parser.registerPrefix(token.IMPORT, parser.parseImportExpression)
 
 	// Infix parsers
 	parser.registerInfix(token.PLUS, parser.parseInfixExpression)
@@ -55,6 +77,7 @@ func New(lexer *lexer.Lexer) *Parser {
 	parser.registerInfix(token.GT, parser.parseInfixExpression)
 	parser.registerInfix(token.LPAREN, parser.parseCallExpression)
 	parser.registerInfix(token.LBRACKET, parser.parseIndexExpression)
+	parser.registerInfix(token.DOT, parser.parseDotExpression)
 
 	return parser
 }
@@ -67,6 +90,12 @@ func (p *Parser) registerInfix(tokenType token.TokenType, fn infixParsingFunctio
 	p.infixParsers[tokenType] = fn
 }
 
+// addError records a parsing error reported at the given token.
+func (p *Parser) addError(tok token.Token, msg string) {
+	p.Errors = append(p.Errors, msg)
+	p.ErrorTokens = append(p.ErrorTokens, tok)
+}
+
 func (p *Parser) Next() {
 	p.curToken = p.peekToken
 	p.peekToken = p.lexer.NextToken()
@@ -98,6 +127,12 @@ func (p *Parser) parseStatement() *ast.Statement {
 		stmt = p.parseReturnStatement()
 	case token.LOOP:
 		stmt = p.parseLoopStatement()
+	case token.IMPORT:
+		if p.peekToken.Type == token.LPAREN {
+			stmt = p.parseExpressionStatement()
+		} else {
+			stmt = p.parseImportStatement()
+		}
 	default:
 		stmt = p.parseExpressionStatement()
 	}
@@ -138,12 +173,12 @@ func (p *Parser) parseLoopStatement() *ast.LoopStatement {
 	p.Next()
 	if p.curToken.Type == token.RPAREN {
 		// empty condition not allowed
-		p.Errors = append(p.Errors, "empty condition not allowed")
+		p.addError(p.curToken, "empty condition not allowed")
 		return nil
 	}
 	stmt.Condition = p.parseExpression(LowestPrecedence)
 	if p.peekToken.Type != token.RPAREN {
-		p.Errors = append(p.Errors, "incomplete condition")
+		p.addError(p.peekToken, "incomplete condition")
 		return nil
 	} else {
 		p.Next()
@@ -153,6 +188,21 @@ func (p *Parser) parseLoopStatement() *ast.LoopStatement {
 	return stmt
 }
 
+func (p *Parser) parseImportStatement() *ast.ImportStatement {
+	stmt := &ast.ImportStatement{
+		Token: p.curToken,
+	}
+
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	stmt.Path = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	if !p.expectPeek(token.SEMICOLON) {
+		return nil
+	}
+	return stmt
+}
+
 func (p *Parser) parseReturnStatement() *ast.ReturnStatement {
 	stmt := &ast.ReturnStatement{
 		Token: p.curToken,
@@ -175,25 +225,123 @@ func (p *Parser) parseExpressionStatement() *ast.ExpressionStatement {
 	// Semicolon is optional for an expression statement for convenience in REPL
 	if p.peekToken.Type == token.SEMICOLON {
 		p.Next()
+	} else if p.strictSemicolons && stmt.Expr != nil && !p.endsStatement() {
+		errMsg := fmt.Sprintf("expected token %s after expression, got %s", token.SEMICOLON, p.peekToken.Type)
+		p.addError(p.peekToken, errMsg)
 	}
 
 	return stmt
 }
 
+// endsStatement reports whether an expression statement ending at the current token needs no semicolon, as it ends with
+// a block or the program or block it is in ends after it.
+func (p *Parser) endsStatement() bool {
+	return p.curToken.Type == token.RBRACE || p.peekToken.Type == token.RBRACE || p.peekToken.Type == token.EOF
+}
+
 func (p *Parser) parseIdentifier() ast.Expression {
 	ident := &ast.Identifier{
 		Token: p.curToken,
 		Value: p.curToken.Literal,
 	}
 
+	if ident.Value == "match" && p.peekToken.Type == token.LPAREN {
+		return p.parseMatchOrCall(ident)
+	}
 	return ident
 }
 
+// parseMatchOrCall parses match (subject) { arms }. match is not a keyword, so that the match builtin stays callable:
+// without a following brace, match(...) is parsed as a call.
+func (p *Parser) parseMatchOrCall(ident *ast.Identifier) ast.Expression {
+	p.Next()
+	callToken := p.curToken
+	args := p.parseCommaSeparatedExpressions(token.RPAREN)
+	if len(args) != 1 || p.peekToken.Type != token.LBRACE {
+		return &ast.CallExpression{Token: callToken, Function: ident, Arguments: args}
+	}
+
+	me := &ast.MatchExpression{Token: ident.Token, Subject: args[0]}
+	p.Next()
+	for p.peekToken.Type != token.RBRACE {
+		p.Next()
+		arm := &ast.MatchArm{Pattern: p.parseExpression(LowestPrecedence)}
+		if !p.checkPattern(arm.Pattern, map[string]bool{}) {
+			return nil
+		}
+		if !p.expectPeek(token.ARROW) {
+			return nil
+		}
+		p.Next()
+		arm.Body = p.parseExpression(LowestPrecedence)
+		me.Arms = append(me.Arms, arm)
+
+		if p.peekToken.Type != token.RBRACE && !p.expectPeek(token.SEMICOLON) {
+			return nil
+		}
+	}
+	p.Next()
+	return me
+}
+
+// checkPattern reports whether pattern is a valid match pattern, recording an error if not. bound collects the names
+// bound so far, as a name may only be bound once per pattern.
+func (p *Parser) checkPattern(pattern ast.Expression, bound map[string]bool) bool {
+	switch pattern := pattern.(type) {
+	case *ast.IntegerLiteral, *ast.StringLiteral, *ast.BooleanLiteral:
+		return true
+	case *ast.PrefixExpression:
+		if _, ok := pattern.Right.(*ast.IntegerLiteral); ok && pattern.Operator == "-" {
+			return true
+		}
+	case *ast.Identifier:
+		if pattern.Value != "_" && bound[pattern.Value] {
+			p.addError(pattern.Token, fmt.Sprintf("%s is bound more than once in pattern", pattern.Value))
+			return false
+		}
+		bound[pattern.Value] = true
+		return true
+	case *ast.ArrayLiteral:
+		for _, element := range pattern.Elements {
+			if !p.checkPattern(element, bound) {
+				return false
+			}
+		}
+		return true
+	case *ast.HashLiteral:
+		for _, pair := range pattern.Pairs {
+			switch pair.Key.(type) {
+			case *ast.Identifier, *ast.IntegerLiteral, *ast.StringLiteral, *ast.BooleanLiteral:
+			default:
+				p.addError(p.curToken, fmt.Sprintf("invalid hash pattern key %s", pair.Key))
+				return false
+			}
+			if !p.checkPattern(pair.Value, bound) {
+				return false
+			}
+		}
+		return true
+	case nil:
+		return false
+	}
+	p.addError(p.curToken, fmt.Sprintf("invalid pattern %s", pattern))
+	return false
+}
+
 func (p *Parser) parseIntegerLiteral() ast.Expression {
 	exp := &ast.IntegerLiteral{Token: p.curToken}
-	value, err := strconv.ParseInt(p.curToken.Literal, 0, 64)
+	literal := p.curToken.Literal
+	if strings.Contains(literal, "_") {
+		// the lexer only starts a number on a digit, so a misplaced underscore is a trailing or doubled one
+		if strings.HasSuffix(literal, "_") || strings.Contains(literal, "__") {
+			p.addError(p.curToken, fmt.Sprintf("invalid digit separator in %q, underscores must sit between digits", literal))
+			return nil
+		}
+		literal = strings.ReplaceAll(literal, "_", "")
+	}
+	value, err := strconv.ParseInt(literal, 0, 64)
 	if err != nil {
-		p.Errors = append(p.Errors, fmt.Sprintf("cannot parse %q as integer", p.curToken.Literal))
+		p.addError(p.curToken, fmt.Sprintf("cannot parse %q as integer", p.curToken.Literal))
 		return nil
 	}
 	exp.Value = value
@@ -205,6 +353,21 @@ func (p *Parser) parseStringLiteral() ast.Expression {
 	return exp
 }
 
+func (p *Parser) parseImportExpression() ast.Expression {
+	exp := &ast.ImportExpression{Token: p.curToken}
+	if !p.expectPeek(token.LPAREN) {
+		return nil
+	}
+	if !p.expectPeek(token.STRING) {
+		return nil
+	}
+	exp.Path = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	if !p.expectPeek(token.RPAREN) {
+		return nil
+	}
+	return exp
+}
+
 func (p *Parser) parseBooleanLiteral() ast.Expression {
 	exp := &ast.BooleanLiteral{Token: p.curToken}
 	exp.Value = p.curToken.Literal == "true"
@@ -235,6 +398,20 @@ func (p *Parser) parseMacroLiteral() ast.Expression {
 	return exp
 }
 
+func (p *Parser) parseDoExpression() ast.Expression {
+	exp := &ast.DoExpression{
+		Token: p.curToken,
+	}
+	if !p.expectPeek(token.LBRACE) {
+		return nil
+	}
+	exp.Body = p.parseBlockStatement()
+	if exp.Body == nil {
+		return nil
+	}
+	return exp
+}
+
 func (p *Parser) parseIfElseConditional() ast.Expression {
 	exp := &ast.IfElseConditional{
 		Token: p.curToken,
@@ -245,12 +422,12 @@ func (p *Parser) parseIfElseConditional() ast.Expression {
 	p.Next()
 	if p.curToken.Type == token.RPAREN {
 		// empty condition not allowed
-		p.Errors = append(p.Errors, "empty condition not allowed")
+		p.addError(p.curToken, "empty condition not allowed")
 		return nil
 	}
 	exp.Condition = p.parseExpression(LowestPrecedence)
 	if p.peekToken.Type != token.RPAREN {
-		p.Errors = append(p.Errors, "incomplete condition")
+		p.addError(p.peekToken, "incomplete condition")
 		return nil
 	} else {
 		p.Next()
@@ -286,7 +463,7 @@ func (p *Parser) parseFunctionParams() []*ast.Identifier {
 	}
 
 	if p.curToken.Type != token.RPAREN {
-		p.Errors = append(p.Errors, "incomplete arguments")
+		p.addError(p.curToken, "incomplete arguments")
 		return nil
 	}
 
@@ -307,7 +484,7 @@ func (p *Parser) parseCommaSeparatedExpressions(endToken token.TokenType) []ast.
 	}
 
 	if p.curToken.Type != endToken {
-		p.Errors = append(p.Errors, "incomplete arguments")
+		p.addError(p.curToken, "incomplete arguments")
 		return nil
 	}
 	return arguments
@@ -315,7 +492,7 @@ func (p *Parser) parseCommaSeparatedExpressions(endToken token.TokenType) []ast.
 
 func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	if p.curToken.Type != token.LBRACE {
-		p.Errors = append(p.Errors, "block statement required")
+		p.addError(p.curToken, "block statement required")
 		return nil
 	}
 	p.Next()
@@ -333,19 +510,38 @@ func (p *Parser) parseBlockStatement() *ast.BlockStatement {
 	}
 
 	if p.curToken.Type != token.RBRACE {
-		p.Errors = append(p.Errors, "incomplete block statement")
+		p.addError(p.curToken, "incomplete block statement")
 		return nil
 	}
 	program.Statements = statements
 	return program
 }
 
+// ParseExpression parses the whole input as a single expression, optionally followed by a semicolon. It returns the
+// first error found, including any tokens left after the expression.
+func (p *Parser) ParseExpression() (ast.Expression, error) {
+	exp := p.parseExpression(LowestPrecedence)
+	if p.peekToken.Type == token.SEMICOLON {
+		p.Next()
+	}
+	if len(p.Errors) == 0 && p.peekToken.Type != token.EOF {
+		p.addError(p.peekToken, fmt.Sprintf("unexpected token %s after expression", p.peekToken.Literal))
+	}
+	if len(p.Errors) != 0 {
+		return nil, errors.New(p.Errors[0])
+	}
+	return exp, nil
+}
+
 func (p *Parser) parseExpression(precedence int) ast.Expression {
 	var leftExp ast.Expression
 	if prefixParser, ok := p.prefixParsers[p.curToken.Type]; ok {
 		leftExp = prefixParser()
+	} else if p.curToken.Type == token.ILLEGAL && p.curToken.Literal[0] >= '0' && p.curToken.Literal[0] <= '9' {
+		p.addError(p.curToken, fmt.Sprintf("invalid number literal %s", p.curToken.Literal))
+		return leftExp
 	} else {
-		p.Errors = append(p.Errors, fmt.Sprintf("no prefix parsing function registered for %s", p.curToken.Type))
+		p.addError(p.curToken, fmt.Sprintf("no prefix parsing function registered for %s", p.curToken.Type))
 		return leftExp
 	}
 
@@ -404,6 +600,19 @@ func (p *Parser) parseIndexExpression(left ast.Expression) ast.Expression {
 	return ie
 }
 
+// parseDotExpression parses left.key as sugar for left["key"].
+func (p *Parser) parseDotExpression(left ast.Expression) ast.Expression {
+	ie := &ast.IndexExpression{
+		Token: p.curToken,
+		Left:  left,
+	}
+	if !p.expectPeek(token.IDENT) {
+		return nil
+	}
+	ie.Index = &ast.StringLiteral{Token: p.curToken, Value: p.curToken.Literal}
+	return ie
+}
+
 func (p *Parser) parseArrayLiteral() ast.Expression {
 	al := &ast.ArrayLiteral{
 		Token: p.curToken,
@@ -418,7 +627,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	}
 
 	p.Next()
-	pairs := make(map[ast.Expression]ast.Expression)
+	var pairs []ast.HashPair
 	for p.curToken.Type != token.EOF && p.curToken.Type != token.RBRACE {
 		key := p.parseExpression(LowestPrecedence)
 		if !p.expectPeek(token.COLON) {
@@ -426,7 +635,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 		}
 		p.Next()
 		val := p.parseExpression(LowestPrecedence)
-		pairs[key] = val
+		pairs = append(pairs, ast.HashPair{Key: key, Value: val})
 		p.Next()
 		if p.curToken.Type == token.COMMA {
 			p.Next()
@@ -434,7 +643,7 @@ func (p *Parser) parseHashLiteral() ast.Expression {
 	}
 
 	if p.curToken.Type != token.RBRACE {
-		p.Errors = append(p.Errors, "incomplete hash expression")
+		p.addError(p.curToken, "incomplete hash expression")
 		return nil
 	}
 
@@ -461,7 +670,7 @@ func (p *Parser) expectPeek(tokenType token.TokenType) bool {
 		return true
 	} else {
 		errMsg := fmt.Sprintf("expected token %s, got %s", tokenType, p.peekToken.Type)
-		p.Errors = append(p.Errors, errMsg)
+		p.addError(p.peekToken, errMsg)
 		return false
 	}
 }
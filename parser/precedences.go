@@ -24,6 +24,7 @@ var precedenceByToken = map[token.TokenType]int{
 	token.GT:       LtPrecedence,
 	token.LPAREN:   CallPrecedence,
 	token.LBRACKET: IndexPrecedence,
+	token.DOT:      IndexPrecedence,
 }
 
 func getTokenPrecedence(tokenType token.TokenType) int {
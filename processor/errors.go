@@ -0,0 +1,115 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+)
+
+// Phase names the stage of processing in which an error occurred.
+type Phase string
+
+const (
+	FilePhase    Phase = "file"
+	ParsePhase   Phase = "parse"
+	CompilePhase Phase = "compile"
+	RuntimePhase Phase = "runtime"
+)
+
+// ErrIsDirectory is wrapped by the *FileError returned for a program path naming a directory.
+var ErrIsDirectory = errors.New("is a directory")
+
+// FileError is returned when the program file cannot be read. Err is the underlying error, so errors.Is can tell a
+// missing file (fs.ErrNotExist), a permission problem (fs.ErrPermission) and a directory (ErrIsDirectory) apart.
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (err *FileError) Error() string {
+	var message string
+	switch {
+	case errors.Is(err.Err, fs.ErrNotExist):
+		message = fmt.Sprintf("%s does not exist", err.Path)
+	case errors.Is(err.Err, ErrIsDirectory):
+		message = fmt.Sprintf("%s is a directory, not a source file", err.Path)
+	case errors.Is(err.Err, fs.ErrPermission):
+		message = fmt.Sprintf("permission denied reading %s", err.Path)
+	default:
+		message = err.Err.Error()
+	}
+	return formatError(FilePhase, 0, 0, message)
+}
+
+func (err *FileError) Unwrap() error {
+	return err.Err
+}
+
+func (err *FileError) Phase() Phase {
+	return FilePhase
+}
+
+// ParseError is returned when the source cannot be parsed.
+type ParseError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (err *ParseError) Error() string {
+	return formatError(ParsePhase, err.Line, err.Column, err.Message)
+}
+
+func (err *ParseError) Phase() Phase {
+	return ParsePhase
+}
+
+// CompileError is returned when the program cannot be compiled to bytecode, which includes macro expansion failures.
+type CompileError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (err *CompileError) Error() string {
+	return formatError(CompilePhase, err.Line, err.Column, err.Message)
+}
+
+func (err *CompileError) Phase() Phase {
+	return CompilePhase
+}
+
+// Warning is a likely mistake the compiler reports without failing, returned by Warnings.
+type Warning struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (warning Warning) String() string {
+	return fmt.Sprintf("warning at %d:%d: %s", warning.Line, warning.Column, warning.Message)
+}
+
+// RuntimeError is returned when execution of the program fails. Line and Column locate the failing node, both 0 for a
+// failure outside of the program, like flushing its output.
+type RuntimeError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (err *RuntimeError) Error() string {
+	return formatError(RuntimePhase, err.Line, err.Column, err.Message)
+}
+
+func (err *RuntimeError) Phase() Phase {
+	return RuntimePhase
+}
+
+// formatError renders an error message prefixed with its phase and, when known, its position.
+func formatError(phase Phase, line, column int, message string) string {
+	if line == 0 {
+		return fmt.Sprintf("%s error: %s", phase, message)
+	}
+	return fmt.Sprintf("%s error at %d:%d: %s", phase, line, column, message)
+}
@@ -0,0 +1,153 @@
+package processor
+
+import (
+	"errors"
+	"fmt"
+	"github.com/jatin-malik/yal/object"
+	"io"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// engineSeeds are programs from the engine tests, on which both engines agree.
+var engineSeeds = []string{
+	`1 + 2 * 3 - 4 / 2`,
+	`let x = 5; let y = x * 2; [x, y, x + y]`,
+	`if (5 > 3) { 10 } else { 20 }`,
+	`let add = fn(a, b) { a + b }; add(1, add(2, 3))`,
+	`let newAdder = fn(x) { fn(y) { x + y } }; let addTwo = newAdder(2); addTwo(3)`,
+	`let fib = fn(n) { if (n < 2) { return n; } fib(n - 1) + fib(n - 2) }; fib(10)`,
+	`let i = 0; let sum = 0; loop (i < 5) { let sum = sum + i; let i = i + 1; } sum`,
+	`{"name": "Alice", "age": 25}["name"]`,
+	`let h = {"a": [1, 2], "b": {"c": 3}}; h.b.c + h["a"][1]`,
+	`len("hello") + len([1, 2, 3])`,
+	`push(rest([1, 2, 3]), first([4]))`,
+	`"ab" * 3 + "c"`,
+	`match ([1, [2, 3]]) { [a, [b, c]] => a + b + c; _ => 0 }`,
+	`let double = fn(x) { x * 2 }; let inc = fn(x) { x + 1 }; pipe(double, inc)(5)`,
+	`deepequal([1, {"a": 2}], [1, {"a": 2}])`,
+	`let unless = macro(c, a, b) { quote(if (!(unquote(c))) { unquote(a) } else { unquote(b) }) }; unless(1 > 2, "yes", "no")`,
+	`1 + "a"`,
+	`[1, 2][5]`,
+	`5 / 0`,
+	`let f = fn(a) { a }; f()`,
+	`{[1]: 2}`,
+}
+
+// FuzzEnginesAgree runs each input through the evaluator and the VM and fails if they disagree: one fails and the other
+// does not, they produce different results or they fail with different errors. Error messages are compared ignoring
+// case and the VM's source positions. Programs that run too long are skipped.
+func FuzzEnginesAgree(f *testing.F) {
+	for _, seed := range engineSeeds {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		evalOutcome, ok := runIsolated(input, "eval")
+		if !ok {
+			t.Skip("eval did not finish in time")
+		}
+		vmOutcome, ok := runIsolated(input, "vm")
+		if !ok {
+			t.Skip("vm did not finish in time")
+		}
+
+		if !evalOutcome.agrees(vmOutcome) {
+			t.Errorf("engines diverge on %q:\neval: %s\nvm:   %s", input, evalOutcome, vmOutcome)
+		}
+	})
+}
+
+// outcome is how a program ended on one engine.
+type outcome struct {
+	result object.Object
+	err    string // message of the error the program failed with, empty if it did not
+}
+
+func (o outcome) agrees(other outcome) bool {
+	if o.err != "" || other.err != "" {
+		return strings.EqualFold(o.err, other.err)
+	}
+	if o.result == nil || other.result == nil {
+		return o.result == other.result
+	}
+	// hashes have no stable Inspect order, DeepEqual compares them by content
+	return object.DeepEqual(o.result, other.result) || o.result.Inspect() == other.result.Inspect()
+}
+
+func (o outcome) String() string {
+	if o.err != "" {
+		return "error: " + o.err
+	}
+	if o.result == nil {
+		return "no result"
+	}
+	return o.result.Inspect()
+}
+
+// runIsolated runs input on engine with output discarded, a fresh environment and sleeps skipped, turning a panic of
+// the engine into an error. It interrupts a program still running after a second and reports whether the program
+// finished.
+func runIsolated(input string, engine string) (outcome, bool) {
+	output, lookupEnv, setEnv, sleep := object.Output, object.LookupEnv, object.SetEnv, object.Sleep
+	defer func() {
+		object.Output, object.LookupEnv, object.SetEnv, object.Sleep = output, lookupEnv, setEnv, sleep
+		object.Interrupted = nil
+	}()
+
+	env := map[string]string{}
+	object.Output = io.Discard
+	object.LookupEnv = func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	object.SetEnv = func(name, value string) error {
+		env[name] = value
+		return nil
+	}
+	object.Sleep = func(time.Duration) {}
+	var interrupted atomic.Bool
+	object.Interrupted = interrupted.Load
+
+	done := make(chan outcome, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				done <- outcome{err: fmt.Sprintf("panic: %v", r)}
+			}
+		}()
+		result, err := Run(input, engine)
+		done <- outcome{result: result, err: errorMessage(err)}
+	}()
+
+	select {
+	case o := <-done:
+		return o, true
+	case <-time.After(time.Second):
+		// wait for the program to stop, so it does not outlive the globals swapped for it
+		interrupted.Store(true)
+		<-done
+		return outcome{}, false
+	}
+}
+
+// errorMessage returns the message of err without the phase and position prefix, empty for a nil err.
+func errorMessage(err error) string {
+	var runtimeErr *RuntimeError
+	var compileErr *CompileError
+	var parseErr *ParseError
+	switch {
+	case err == nil:
+		return ""
+	case errors.As(err, &runtimeErr):
+		return runtimeErr.Message
+	case errors.As(err, &compileErr):
+		return compileErr.Message
+	case errors.As(err, &parseErr):
+		return parseErr.Message
+	default:
+		return err.Error()
+	}
+}
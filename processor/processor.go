@@ -1,55 +1,243 @@
 package processor
 
 import (
+	"errors"
 	"fmt"
+	"github.com/jatin-malik/yal/ast"
 	"github.com/jatin-malik/yal/compiler"
 	"github.com/jatin-malik/yal/evaluator"
 	"github.com/jatin-malik/yal/lexer"
+	"github.com/jatin-malik/yal/module"
 	"github.com/jatin-malik/yal/object"
 	"github.com/jatin-malik/yal/parser"
 	"github.com/jatin-malik/yal/vm"
+	"os"
 )
 
+// Version is the version of yal, set at build time with
+// -ldflags "-X github.com/jatin-malik/yal/processor.Version=v1.0.0".
+var Version = "dev"
+
+// Strict turns the implicit nulls of an if without else used as a value and of a missing hash key into runtime errors,
+// in both engines.
+var Strict bool
+
+// Process runs the input with the provided engine and prints the result or any errors to stdout.
 func Process(input string, engine string) {
-	l := lexer.New(input)
-	p := parser.New(l)
-	prg := p.ParseProgram()
-	if len(p.Errors) != 0 {
-		for _, msg := range p.Errors {
-			fmt.Println(msg)
-		}
+	obj, err := Run(input, engine)
+	if err != nil {
+		fmt.Println(err)
 		return
 	}
 
-	macroEnv := object.NewEnvironment(nil)
-	expandedAST, err := evaluator.ExpandMacro(prg, macroEnv)
+	if obj != nil {
+		fmt.Println(obj.Inspect())
+	}
+}
+
+// RunFile reads the program from filename and runs it with the provided engine. args are exposed to the program through
+// the args builtin. A file that cannot be read is reported as *FileError, other failures as with Run.
+func RunFile(filename string, engine string, args []string) (object.Object, error) {
+	input, err := ReadSource(filename)
 	if err != nil {
-		fmt.Println(err)
-		return
+		return nil, err
+	}
+
+	object.Args = args
+	return run(input, filename, engine)
+}
+
+// ReadSource reads the program stored in filename. Failures are reported as *FileError.
+func ReadSource(filename string) (string, error) {
+	info, err := os.Stat(filename)
+	if err != nil {
+		return "", &FileError{Path: filename, Err: err}
 	}
+	if info.IsDir() {
+		return "", &FileError{Path: filename, Err: ErrIsDirectory}
+	}
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", &FileError{Path: filename, Err: err}
+	}
+	return string(data), nil
+}
 
-	var obj object.Object
-	if engine == "eval" {
-		env := object.NewEnvironment(nil)
-		obj = evaluator.Eval(expandedAST, env)
-	} else if engine == "vm" {
-		compiler := compiler.New()
-		err = compiler.Compile(expandedAST)
+// Run parses, macro expands and executes the input with the provided engine ( vm or eval ) and returns the resulting
+// object. A program without a value, like an empty one, one of only comments or one ending with a let, gives a nil
+// object and no error. Failures are reported as *ParseError, *CompileError or *RuntimeError.
+func Run(input string, engine string) (object.Object, error) {
+	return run(input, "", engine)
+}
+
+// run executes input read from the file at path, empty if the input did not come from a file. Buffered output is
+// flushed once the program ends, whether it fails or not, and a failed flush of a program that succeeded is reported
+// as a *RuntimeError. The result never is a *object.ReturnValue, hosts get the returned value itself.
+func run(input string, path string, engine string) (result object.Object, err error) {
+	defer func() {
+		for object.IsReturnValue(result) {
+			result = result.(*object.ReturnValue).Value
+		}
+		if flushErr := object.FlushOutput(); flushErr != nil && err == nil {
+			result, err = nil, &RuntimeError{Message: flushErr.Error()}
+		}
+	}()
+
+	expandedAST, err := parse(input, path)
+	if err != nil {
+		return nil, err
+	}
+
+	switch engine {
+	case "eval":
+		return evaluate(expandedAST.(*ast.Program))
+	case "vm":
+		c, err := compile(expandedAST)
 		if err != nil {
-			fmt.Println(err)
-			return
+			return nil, err
+		}
+		bytecode := c.Output()
+		var options []vm.StackVMOption
+		if Strict {
+			options = append(options, vm.WithStrict())
 		}
-		bytecode := compiler.Output()
-		vm := vm.NewStackVM(bytecode.Instructions, bytecode.ConstantPool)
-		err = vm.Run()
+		options = append(options, vm.WithSourceMap(bytecode.SourceMap))
+		machine := vm.NewStackVM(bytecode.Instructions, bytecode.ConstantPool, options...)
+		err = machine.Run()
 		if err != nil {
-			fmt.Println(err)
-			return
+			runtimeErr := &RuntimeError{Message: err.Error()}
+			var posErr *vm.Error
+			if errors.As(err, &posErr) {
+				runtimeErr.Line, runtimeErr.Column = posErr.Token.Line, posErr.Token.Column
+			}
+			return nil, runtimeErr
 		}
-		obj = vm.Top()
+		return machine.Top(), nil
+	default:
+		return nil, fmt.Errorf("unknown engine %q", engine)
 	}
+}
 
-	if obj != nil {
-		fmt.Println(obj.Inspect())
+// evaluate runs the macro expanded program with the evaluator, reporting a failure as *RuntimeError.
+func evaluate(prg *ast.Program) (object.Object, error) {
+	evaluator.Strict = Strict
+	result := evaluator.Eval(prg, object.NewEnvironment(nil))
+	if err, ok := result.(*object.Error); ok {
+		return nil, &RuntimeError{Line: err.Token.Line, Column: err.Token.Column, Message: err.Message}
+	}
+	return result, nil
+}
+
+// Compile parses, macro expands and compiles the input to bytecode. Failures are reported as *ParseError or
+// *CompileError.
+func Compile(input string) (compiler.ByteCode, error) {
+	return compileSource(input, "")
+}
+
+// compileSource compiles input read from the file at path, empty if the input did not come from a file.
+func compileSource(input string, path string) (compiler.ByteCode, error) {
+	expandedAST, err := parse(input, path)
+	if err != nil {
+		return compiler.ByteCode{}, err
+	}
+	c, err := compile(expandedAST)
+	if err != nil {
+		return compiler.ByteCode{}, err
+	}
+	return c.Output(), nil
+}
+
+// Warnings parses, macro expands and compiles the input like Compile and returns the compiler warnings in source order,
+// such as a let rebinding a name already defined in the same scope. Failures are reported as with Compile.
+func Warnings(input string) ([]Warning, error) {
+	expandedAST, err := parse(input, "")
+	if err != nil {
+		return nil, err
+	}
+	c, err := compile(expandedAST, compiler.WithWarnings())
+	if err != nil {
+		return nil, err
+	}
+
+	var warnings []Warning
+	for _, warning := range c.Warnings() {
+		warnings = append(warnings, Warning{Line: warning.Token.Line, Column: warning.Token.Column, Message: warning.Message})
+	}
+	return warnings, nil
+}
+
+// Check parses, macro expands and compiles the input without executing it and returns every error found. A nil result
+// means the program builds.
+func Check(input string) []error {
+	return check(input, "")
+}
+
+// CheckFile reads the program from filename and checks it like Check, resolving its imports relative to the directory
+// of filename as RunFile does. A file that cannot be read is reported as a *FileError.
+func CheckFile(filename string) []error {
+	input, err := ReadSource(filename)
+	if err != nil {
+		return []error{err}
+	}
+	return check(input, filename)
+}
+
+// check checks input read from the file at path, empty if the input did not come from a file.
+func check(input string, path string) []error {
+	_, err := compileSource(input, path)
+	if err == nil {
+		return nil
+	}
+	if joined, ok := err.(interface{ Unwrap() []error }); ok {
+		return joined.Unwrap()
+	}
+	return []error{err}
+}
+
+// parse parses the input read from the file at path, requiring semicolons between statements, resolves its imports and
+// macro expands it. All parser errors are joined into the returned error.
+func parse(input string, path string) (ast.Node, error) {
+	l := lexer.New(input)
+	options := []parser.Option{parser.WithStrictSemicolons()}
+	p := parser.New(l, options...)
+	prg := p.ParseProgram()
+	if len(p.Errors) != 0 {
+		var errs []error
+		for i, msg := range p.Errors {
+			tok := p.ErrorTokens[i]
+			errs = append(errs, &ParseError{Line: tok.Line, Column: tok.Column, Message: msg})
+		}
+		return nil, errors.Join(errs...)
+	}
+
+	resolvedAST, err := module.Resolve(prg, path, options...)
+	if err != nil {
+		return nil, &CompileError{Message: err.Error()}
+	}
+
+	macroEnv := object.NewEnvironment(nil)
+	expandedAST, err := evaluator.ExpandMacro(resolvedAST, macroEnv)
+	if err != nil {
+		return nil, &CompileError{Message: err.Error()}
+	}
+	return expandedAST, nil
+}
+
+// compile compiles node with the options set for the package and any given ones.
+func compile(node ast.Node, options ...compiler.Option) (*compiler.Compiler, error) {
+	if Strict {
+		options = append(options, compiler.WithStrict())
+	}
+	c := compiler.New(options...)
+	err := c.Compile(node)
+	if err != nil {
+		compileErr := &CompileError{Message: err.Error()}
+		var posErr *compiler.Error
+		if errors.As(err, &posErr) {
+			compileErr.Line, compileErr.Column = posErr.Token.Line, posErr.Token.Column
+		}
+		return nil, compileErr
 	}
+	return c, nil
 }
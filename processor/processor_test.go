@@ -0,0 +1,663 @@
+package processor
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/jatin-malik/yal/object"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunErrorTypes(t *testing.T) {
+	tests := []struct {
+		input          string
+		engine         string
+		expectedPhase  Phase
+		expectedLine   int
+		expectedColumn int
+	}{
+		// Parse errors
+		{"let x 5;", "vm", ParsePhase, 1, 7},
+		{"let x = 5;\nif () { 1 }", "eval", ParsePhase, 2, 5},
+		{"puts(1)\nputs(2)", "vm", ParsePhase, 2, 1},
+
+		// Compile errors
+		{"let x = 5;\n  y + x", "vm", CompilePhase, 2, 3},
+		{`let m = macro(a) { 1 / 0 }; m(1)`, "eval", CompilePhase, 0, 0},
+
+		// Runtime errors
+		{"1 / 0", "vm", RuntimePhase, 1, 3},
+		{"1 / 0", "eval", RuntimePhase, 1, 3},
+		{`len(1)`, "vm", RuntimePhase, 1, 4},
+		{`len(1)`, "eval", RuntimePhase, 1, 4},
+		{"let f = fn(x) {\n  x / 0\n};\nf(1)", "vm", RuntimePhase, 2, 5},
+		{`y`, "eval", RuntimePhase, 1, 1},
+		{"let f = fn(x) {\n  x / 0\n};\nf(1)", "eval", RuntimePhase, 2, 5},
+		{"let a = 1;\n[a, len(a)]", "vm", RuntimePhase, 2, 8},
+		{"let a = 1;\n[a, len(a)]", "eval", RuntimePhase, 2, 8},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.engine+"/"+tt.input, func(t *testing.T) {
+			obj, err := Run(tt.input, tt.engine)
+			if err == nil {
+				t.Fatalf("expected an error, got %v", obj)
+			}
+
+			var phase Phase
+			var line, column int
+			switch tt.expectedPhase {
+			case ParsePhase:
+				var parseErr *ParseError
+				if !errors.As(err, &parseErr) {
+					t.Fatalf("expected *ParseError, got %T: %v", err, err)
+				}
+				phase, line, column = parseErr.Phase(), parseErr.Line, parseErr.Column
+			case CompilePhase:
+				var compileErr *CompileError
+				if !errors.As(err, &compileErr) {
+					t.Fatalf("expected *CompileError, got %T: %v", err, err)
+				}
+				phase, line, column = compileErr.Phase(), compileErr.Line, compileErr.Column
+			case RuntimePhase:
+				var runtimeErr *RuntimeError
+				if !errors.As(err, &runtimeErr) {
+					t.Fatalf("expected *RuntimeError, got %T: %v", err, err)
+				}
+				phase, line, column = runtimeErr.Phase(), runtimeErr.Line, runtimeErr.Column
+			}
+
+			if phase != tt.expectedPhase {
+				t.Errorf("expected phase %s, got %s", tt.expectedPhase, phase)
+			}
+			if line != tt.expectedLine || column != tt.expectedColumn {
+				t.Errorf("expected position %d:%d, got %d:%d", tt.expectedLine, tt.expectedColumn, line, column)
+			}
+			if prefix := fmt.Sprintf("%s error: ", phase); line == 0 && !strings.HasPrefix(err.Error(), prefix) {
+				t.Errorf("expected %q without a position, got %q", prefix, err.Error())
+			}
+		})
+	}
+}
+
+func TestRun(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{"1 + 2", "3"},
+		{`let add = fn(a, b) { a + b }; add(2, 3)`, "5"},
+		{`let unless = macro(c, a, b) { quote(if (!(unquote(c))) { unquote(a) } else { unquote(b) }) }; unless(false, 1, 2)`, "1"},
+	}
+
+	for _, engine := range []string{"vm", "eval"} {
+		for _, tt := range tests {
+			t.Run(engine+"/"+tt.input, func(t *testing.T) {
+				obj, err := Run(tt.input, engine)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if obj.Inspect() != tt.expected {
+					t.Errorf("expected %s, got %s", tt.expected, obj.Inspect())
+				}
+			})
+		}
+	}
+}
+
+func TestRunUnwrapsReturn(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`return 5;`, "5"},
+		{`return 5; 6`, "5"},
+		{`let x = 1; if (x > 0) { return x + 1; } 0`, "2"},
+		{`return [1, 2];`, "[1, 2]"},
+	}
+
+	for _, engine := range []string{"vm", "eval"} {
+		for _, tt := range tests {
+			t.Run(engine+"/"+tt.input, func(t *testing.T) {
+				result, err := Run(tt.input, engine)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if object.IsReturnValue(result) {
+					t.Fatalf("expected the returned value, got %T", result)
+				}
+				if result.Inspect() != tt.expected {
+					t.Errorf("expected %s, got %s", tt.expected, result.Inspect())
+				}
+			})
+		}
+	}
+
+	result, err := Run(`return 5;`, "eval")
+	if _, ok := result.(*object.Integer); err != nil || !ok {
+		t.Errorf("expected *object.Integer, got %T (%v)", result, err)
+	}
+}
+
+func TestRunBangAgrees(t *testing.T) {
+	// ! on any value gives the same boolean in both engines
+	inputs := []string{`!true`, `!5`, `!0`, `!""`, `!"a"`, `![]`, `![0]`, `!{}`, `!fn() { 1 }`, `!puts`,
+		`!if (false) { 1 }`, `!{"a": 1}.b`, `!!0`, `!![]`, `!!if (false) { 1 }`}
+
+	for _, input := range inputs {
+		t.Run(input, func(t *testing.T) {
+			evalResult, err := Run(input, "eval")
+			if err != nil {
+				t.Fatalf("eval: unexpected error: %v", err)
+			}
+			vmResult, err := Run(input, "vm")
+			if err != nil {
+				t.Fatalf("vm: unexpected error: %v", err)
+			}
+			if evalResult != vmResult {
+				t.Errorf("engines diverge: eval gave %s, vm gave %s", evalResult.Inspect(), vmResult.Inspect())
+			}
+		})
+	}
+}
+
+func TestRunLoopConditionShortCircuit(t *testing.T) {
+	defer func(previous io.Writer) { object.Output = previous }(object.Output)
+
+	// there are no && and || yet, an if in the condition skips its second check the same way
+	running := `let running = fn(i) { puts(i); i < 2 };`
+	tests := []struct {
+		input          string
+		expectedOutput string // puts of every call of running, one per evaluation that was not short-circuited
+		expected       int64
+	}{
+		{`let i = 0; loop (if (i < 3) { running(i) } else { false }) { let i = i + 1; } i`, "0\n1\n2\n", 2},
+		{`let i = 0; loop (if (i < 1) { running(i) } else { false }) { let i = i + 1; } i`, "0\n", 1},
+		{`let i = 0; loop (if (i < 0) { running(i) } else { false }) { let i = i + 1; } i`, "", 0},
+		{`let i = 0; loop (if (running(i)) { i < 1 } else { false }) { let i = i + 1; } i`, "0\n1\n", 1},
+		{`let f = fn(n) { let i = 0; loop (if (i < n) { running(i) } else { false }) { let i = i + 1; } i }; f(5)`,
+			"0\n1\n2\n", 2},
+	}
+
+	for _, tt := range tests {
+		for _, engine := range []string{"vm", "eval"} {
+			t.Run(engine+"/"+tt.input, func(t *testing.T) {
+				var out bytes.Buffer
+				object.Output = &out
+
+				result, err := Run(running+tt.input, engine)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if out.String() != tt.expectedOutput {
+					t.Errorf("expected output %q, got %q", tt.expectedOutput, out.String())
+				}
+				if integer, ok := result.(*object.Integer); !ok || integer.Value != tt.expected {
+					t.Errorf("expected %d iterations, got %v", tt.expected, result)
+				}
+			})
+		}
+	}
+}
+
+func TestRunUnhashableKeys(t *testing.T) {
+	tests := []struct {
+		input         string
+		expectedError string
+	}{
+		{`let f = fn(x) { x }; {f: 1}`, "key type FUNCTION is not hashable"},
+		{`let f = fn(x) { x }; {"a": 1}[f]`, "key type FUNCTION is not hashable"},
+		{`let m = macro(x) { {x: 1}; x }; m(1 + 2)`, "macro expansion error: key type QUOTE is not hashable"},
+		{`{[1]: 1}`, "key type ARRAY is not hashable"},
+	}
+
+	for _, tt := range tests {
+		for _, engine := range []string{"vm", "eval"} {
+			t.Run(engine+"/"+tt.input, func(t *testing.T) {
+				_, err := Run(tt.input, engine)
+				if message := errorMessage(err); message != tt.expectedError {
+					t.Errorf("expected error %q, got %v", tt.expectedError, err)
+				}
+			})
+		}
+	}
+}
+
+func TestRunStreamsOutput(t *testing.T) {
+	defer func(previous io.Writer) { object.Output = previous }(object.Output)
+
+	input := `puts("one"); let x = 2; puts(x); x + "three"; puts("four")`
+	for _, engine := range []string{"vm", "eval"} {
+		t.Run(engine, func(t *testing.T) {
+			var out bytes.Buffer
+			object.Output = &out
+
+			_, err := Run(input, engine)
+			var runtimeErr *RuntimeError
+			if !errors.As(err, &runtimeErr) {
+				t.Fatalf("expected *RuntimeError, got %T: %v", err, err)
+			}
+			if out.String() != "one\n2\n" {
+				t.Errorf("expected the output before the error %q, got %q", "one\n2\n", out.String())
+			}
+		})
+	}
+}
+
+func TestRunFlushesBufferedOutput(t *testing.T) {
+	defer func(previous io.Writer) { object.Output, object.BufferOutput = previous, false }(object.Output)
+	object.BufferOutput = true
+
+	for _, engine := range []string{"vm", "eval"} {
+		t.Run(engine, func(t *testing.T) {
+			var out bytes.Buffer
+			object.Output = &out
+
+			if _, err := Run(`puts("one"); flush(); puts("two");`, engine); err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if out.String() != "one\ntwo\n" {
+				t.Errorf("expected the buffered output flushed at the end %q, got %q", "one\ntwo\n", out.String())
+			}
+		})
+	}
+}
+
+func TestRunOutputLimit(t *testing.T) {
+	defer func(previous io.Writer) { object.Output, object.BufferOutput = previous, false }(object.Output)
+
+	input := `let i = 0; loop (i < 1000) { puts("line"); let i = i + 1; }`
+	for _, engine := range []string{"vm", "eval"} {
+		for _, buffered := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s/buffered=%t", engine, buffered), func(t *testing.T) {
+				var out bytes.Buffer
+				object.Output = object.LimitOutput(&out, 12)
+				object.BufferOutput = buffered
+
+				_, err := Run(input, engine)
+				var runtimeErr *RuntimeError
+				if !errors.As(err, &runtimeErr) || runtimeErr.Message != "output limit exceeded" {
+					t.Fatalf("expected runtime error %q, got %v", "output limit exceeded", err)
+				}
+				if out.String() != "line\nline\nli" {
+					t.Errorf("expected the output up to the limit %q, got %q", "line\nline\nli", out.String())
+				}
+			})
+		}
+	}
+}
+
+func TestRunInterrupted(t *testing.T) {
+	defer func() { object.Interrupted, object.Sleep = nil, time.Sleep }()
+	object.Sleep = func(time.Duration) {}
+
+	tests := []string{
+		`loop (true) { }`,
+		`let f = fn(n) { f(n + 1) }; f(0)`,
+		`sleep(1000000); 1`,
+	}
+	for _, input := range tests {
+		for _, engine := range []string{"vm", "eval"} {
+			t.Run(engine+"/"+input, func(t *testing.T) {
+				polls := 0
+				object.Interrupted = func() bool {
+					polls++
+					return polls > 100
+				}
+
+				_, err := Run(input, engine)
+				var runtimeErr *RuntimeError
+				if !errors.As(err, &runtimeErr) || runtimeErr.Message != "interrupted" {
+					t.Fatalf("expected runtime error %q, got %v", "interrupted", err)
+				}
+			})
+		}
+	}
+}
+
+func TestRunStrict(t *testing.T) {
+	tests := []struct {
+		input         string
+		expected      string // result in strict mode
+		expectedError string // runtime error in strict mode
+		lenient       string // result without strict mode
+	}{
+		{`let x = if (false) { 1 }; x`, "", "if without else has no value: condition is false", "null"},
+		{`let f = fn(a) { a }; f(if (1 > 2) { 1 })`, "", "if without else has no value: condition is false", "null"},
+		{`let x = if (true) { 1 }; x`, "1", "", "1"},
+		{`let x = if (false) { 1 } else { 2 }; x`, "2", "", "2"},
+		{`if (false) { 1 }; 3`, "3", "", "3"},
+		{`let f = fn(x) { if (x) { 1 } }; f(false)`, "", "if without else has no value: condition is false", "null"},
+		{`let f = fn(x) { if (x) { 1 }; 2 }; f(false)`, "2", "", "2"},
+		{`let x = do { if (false) { 1 } }; x`, "", "if without else has no value: condition is false", "null"},
+		{`let x = if (true) { if (false) { 1 } } else { 2 }; x`, "", "if without else has no value: condition is false", "null"},
+		{`let x = match (1) { 1 => if (false) { 2 } }; x`, "", "if without else has no value: condition is false", "null"},
+		{`let f = fn() { do { if (false) { 1 } } }; f()`, "", "if without else has no value: condition is false", "null"},
+		{`do { if (false) { 1 } }; 3`, "3", "", "3"},
+		{`let x = do { if (false) { 1 }; 2 }; x`, "2", "", "2"},
+		{`{"a": 1}["b"]`, "", `key "b" not found in hash`, "null"},
+		{`{1: 1}[2]`, "", "key 2 not found in hash", "null"},
+		{`{"a": 1}.a`, "1", "", "1"},
+	}
+
+	defer func() { Strict = false }()
+	for _, engine := range []string{"vm", "eval"} {
+		for _, tt := range tests {
+			t.Run(engine+"/"+tt.input, func(t *testing.T) {
+				Strict = false
+				obj, err := Run(tt.input, engine)
+				if err != nil {
+					t.Fatalf("unexpected error without strict mode: %v", err)
+				}
+				if obj.Inspect() != tt.lenient {
+					t.Errorf("expected %s without strict mode, got %s", tt.lenient, obj.Inspect())
+				}
+
+				Strict = true
+				obj, err = Run(tt.input, engine)
+				if tt.expectedError != "" {
+					var runtimeErr *RuntimeError
+					if !errors.As(err, &runtimeErr) {
+						t.Fatalf("expected *RuntimeError, got %T: %v", err, err)
+					}
+					if runtimeErr.Message != tt.expectedError {
+						t.Errorf("expected error %q, got %q", tt.expectedError, runtimeErr.Message)
+					}
+					return
+				}
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if obj.Inspect() != tt.expected {
+					t.Errorf("expected %s, got %s", tt.expected, obj.Inspect())
+				}
+			})
+		}
+	}
+}
+
+func TestRunProgramWithoutValue(t *testing.T) {
+	inputs := []string{"", "  \n\t", "# nothing to run", "# one\n# two\n", "let x = 1;", "1;\nlet x = 2;"}
+
+	for _, input := range inputs {
+		for _, engine := range []string{"vm", "eval"} {
+			t.Run(engine+"/"+input, func(t *testing.T) {
+				result, err := Run(input, engine)
+				if err != nil || result != nil {
+					t.Errorf("expected no result and no error, got %v and %v", result, err)
+				}
+			})
+		}
+		if errs := Check(input); errs != nil {
+			t.Errorf("%q: expected no errors, got %v", input, errs)
+		}
+	}
+}
+
+func TestCompile(t *testing.T) {
+	if _, err := Compile("let a = 1; a + 1"); err != nil {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	_, err := Compile("a + 1")
+	var compileErr *CompileError
+	if !errors.As(err, &compileErr) {
+		t.Fatalf("expected *CompileError, got %T: %v", err, err)
+	}
+	if compileErr.Error() != "compile error at 1:1: unknown identifier a" {
+		t.Errorf("unexpected error message: %s", compileErr.Error())
+	}
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedErrors []string
+	}{
+		{"let a = 1; a + 1", nil},
+		{`let m = macro(x) { quote(unquote(x) * 2) }; m(4)`, nil},
+		{"let x 5;", []string{"parse error at 1:7: expected token =, got INT"}},
+		{"let x 5; let y 6;", []string{
+			"parse error at 1:7: expected token =, got INT",
+			"parse error at 1:16: expected token =, got INT",
+		}},
+		{"let a = 1;\nb + a", []string{"compile error at 2:1: unknown identifier b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			errs := Check(tt.input)
+			if len(errs) != len(tt.expectedErrors) {
+				t.Fatalf("expected %d errors, got %d: %v", len(tt.expectedErrors), len(errs), errs)
+			}
+			for i, err := range errs {
+				if err.Error() != tt.expectedErrors[i] {
+					t.Errorf("expected error %q, got %q", tt.expectedErrors[i], err.Error())
+				}
+			}
+		})
+	}
+}
+
+func TestCheckFile(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"math.yal":   `let double = fn(x) { x * 2 };`,
+		"main.yal":   `import "math.yal"; double(2)`,
+		"broken.yal": `import "math.yal"; triple(2)`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// imports are relative to the checked file, not to the working directory
+	if errs := CheckFile(filepath.Join(dir, "main.yal")); errs != nil {
+		t.Errorf("expected no errors, got %v", errs)
+	}
+	errs := CheckFile(filepath.Join(dir, "broken.yal"))
+	if len(errs) != 1 || errs[0].Error() != "compile error at 1:20: unknown identifier triple" {
+		t.Errorf("expected the unknown identifier, got %v", errs)
+	}
+
+	errs = CheckFile(filepath.Join(dir, "missing.yal"))
+	var fileErr *FileError
+	if len(errs) != 1 || !errors.As(errs[0], &fileErr) {
+		t.Errorf("expected a *FileError, got %v", errs)
+	}
+}
+
+func TestWarnings(t *testing.T) {
+	tests := []struct {
+		input            string
+		expectedWarnings []string
+	}{
+		{"let x = 1;\nlet x = x + 1;", []string{"warning at 2:5: x is already defined in this scope"}},
+		{"let i = 0; loop (i < 3) { let i = i + 1; }", []string{"warning at 1:31: i is already defined in this scope"}},
+		{"let x = 1; let y = 2; x + y", nil},
+		{"let x = 1; let f = fn(x) { x };", nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			warnings, err := Warnings(tt.input)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(warnings) != len(tt.expectedWarnings) {
+				t.Fatalf("expected %d warnings, got %d: %v", len(tt.expectedWarnings), len(warnings), warnings)
+			}
+			for i, warning := range warnings {
+				if warning.String() != tt.expectedWarnings[i] {
+					t.Errorf("expected warning %q, got %q", tt.expectedWarnings[i], warning.String())
+				}
+			}
+		})
+	}
+
+	// a program that does not build reports the error instead
+	if _, err := Warnings("let x = 1; y"); err == nil {
+		t.Errorf("expected a compile error")
+	}
+}
+
+func TestRunFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	missing := filepath.Join(dir, "missing.yal")
+
+	tests := []struct {
+		filename        string
+		expectedErr     error
+		expectedMessage string
+	}{
+		{missing, fs.ErrNotExist, "file error: " + missing + " does not exist"},
+		{dir, ErrIsDirectory, "file error: " + dir + " is a directory, not a source file"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			obj, err := RunFile(tt.filename, "vm", nil)
+			if err == nil {
+				t.Fatalf("expected an error, got %v", obj)
+			}
+
+			var fileErr *FileError
+			if !errors.As(err, &fileErr) {
+				t.Fatalf("expected *FileError, got %T: %v", err, err)
+			}
+			if fileErr.Phase() != FilePhase {
+				t.Errorf("expected phase %s, got %s", FilePhase, fileErr.Phase())
+			}
+			if !errors.Is(err, tt.expectedErr) {
+				t.Errorf("expected the error to wrap %v, got %v", tt.expectedErr, fileErr.Err)
+			}
+			if err.Error() != tt.expectedMessage {
+				t.Errorf("expected %q, got %q", tt.expectedMessage, err.Error())
+			}
+		})
+	}
+}
+
+func TestRunFileArgs(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "args.yal")
+	program := `let argv = args(); if (len(argv) > 1) { first(argv) + "-" + last(argv) } else { len(argv) }`
+	if err := os.WriteFile(filename, []byte(program), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		args     []string
+		expected string
+	}{
+		{[]string{"hello", "world"}, "hello-world"},
+		{[]string{"only"}, "1"},
+		{nil, "0"},
+	}
+
+	for _, engine := range []string{"vm", "eval"} {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s/%v", engine, tt.args), func(t *testing.T) {
+				obj, err := RunFile(filename, engine, tt.args)
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				if obj.Inspect() != tt.expected {
+					t.Errorf("expected %s, got %s", tt.expected, obj.Inspect())
+				}
+			})
+		}
+	}
+}
+
+func TestRunFileImports(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"math.yal":  `let square = fn(x) { x * x }; let sumOfSquares = fn(a, b) { square(a) + square(b) };`,
+		"main.yal":  `import "math.yal"; sumOfSquares(3, 4)`,
+		"ns.yal":    `let math = import("math.yal"); math["sumOfSquares"](1, 2) + math["square"](3)`,
+		"leak.yal":  `let math = import("math.yal"); square(3)`,
+		"a.yal":     `import "b.yal"; let a = 1; a`,
+		"b.yal":     `import "a.yal"; let b = 2;`,
+		"loose.yal": `let a = 1; puts(a) puts(a)`,
+		"semi.yal":  `import "loose.yal"; a`,
+		"fact.yal":  `let fact = fn(n) { if (n < 2) { 1 } else { n * fact(n - 1) } };`,
+		"parity.yal": `let even = fn(n) { if (n == 0) { true } else { odd(n - 1) } };
+let odd = fn(n) { if (n == 0) { false } else { even(n - 1) } };`,
+		"field.yal":   `let fact = import("fact.yal").fact; fact(5)`,
+		"list.yal":    `[import("fact.yal")][0]["fact"](3)`,
+		"mutual.yal":  `let p = import("parity.yal"); [p.even(10), p.odd(7)]`,
+		"shadow.yal":  `let odd = fn(n) { "importer" }; let p = import("parity.yal"); p.even(3)`,
+		"spliced.yal": `import "parity.yal"; [even(4), odd(4)]`,
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, engine := range []string{"vm", "eval"} {
+		t.Run(engine, func(t *testing.T) {
+			obj, err := RunFile(filepath.Join(dir, "main.yal"), engine, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if obj.Inspect() != "25" {
+				t.Errorf("expected 25, got %s", obj.Inspect())
+			}
+
+			obj, err = RunFile(filepath.Join(dir, "ns.yal"), engine, nil)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if obj.Inspect() != "14" {
+				t.Errorf("expected 14, got %s", obj.Inspect())
+			}
+
+			if _, err = RunFile(filepath.Join(dir, "leak.yal"), engine, nil); err == nil {
+				t.Errorf("expected module members to stay out of the importing scope")
+			}
+
+			_, err = RunFile(filepath.Join(dir, "a.yal"), engine, nil)
+			var compileErr *CompileError
+			if !errors.As(err, &compileErr) {
+				t.Fatalf("expected *CompileError, got %T: %v", err, err)
+			}
+			if compileErr.Message != "import cycle detected: a.yal -> b.yal -> a.yal" {
+				t.Errorf("unexpected error message: %s", compileErr.Message)
+			}
+
+			// modules used anywhere an expression is, with definitions referring to each other and not to the importer
+			for name, expected := range map[string]string{
+				"field.yal":   "120",
+				"list.yal":    "6",
+				"mutual.yal":  "[true, true]",
+				"shadow.yal":  "false",
+				"spliced.yal": "[true, false]",
+			} {
+				obj, err := RunFile(filepath.Join(dir, name), engine, nil)
+				if err != nil {
+					t.Fatalf("%s: unexpected error: %v", name, err)
+				}
+				if obj.Inspect() != expected {
+					t.Errorf("%s: expected %s, got %s", name, expected, obj.Inspect())
+				}
+			}
+
+			// imported files need semicolons too
+			_, err = RunFile(filepath.Join(dir, "semi.yal"), engine, nil)
+			if !errors.As(err, &compileErr) {
+				t.Fatalf("expected *CompileError, got %T: %v", err, err)
+			}
+			expected := `cannot import "` + filepath.Join(dir, "loose.yal") + `": expected token ; after expression, got IDENT`
+			if compileErr.Message != expected {
+				t.Errorf("unexpected error message: %s", compileErr.Message)
+			}
+		})
+	}
+}
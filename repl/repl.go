@@ -2,12 +2,14 @@
 package repl
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"github.com/chzyer/readline"
 	"github.com/jatin-malik/yal/compiler"
 	"github.com/jatin-malik/yal/evaluator"
 	"github.com/jatin-malik/yal/lexer"
+	"github.com/jatin-malik/yal/module"
 	"github.com/jatin-malik/yal/object"
 	"github.com/jatin-malik/yal/parser"
 	"github.com/jatin-malik/yal/vm"
@@ -15,6 +17,21 @@ import (
 	"strings"
 )
 
+// MaxDisplay is the number of elements of an array, or pairs of a hash, shown when printing a result. Longer ones are
+// truncated, see object.InspectTruncated. Zero or less shows results in full.
+var MaxDisplay = 100
+
+// MaxOutput caps the bytes builtins like puts write over a session, see object.LimitOutput. Zero or less writes without
+// limit.
+var MaxOutput int
+
+// Strict turns the implicit nulls of an if without else used as a value and of a missing hash key into runtime errors,
+// in both engines, as processor.Strict does for files.
+var Strict bool
+
+// Start reads statements from the terminal and writes their output and results to out, executing them with the
+// provided engine. Output of builtins like puts goes through the same buffered writer as results, which is flushed
+// after every statement, so side effects always appear before the result they lead to.
 func Start(in io.Reader, out io.Writer, engine string) {
 
 	prompt := ">> "
@@ -24,16 +41,14 @@ func Start(in io.Reader, out io.Writer, engine string) {
 	}
 	defer rl.Close()
 
-	macroEnv := object.NewEnvironment(nil) // shared scope across all macro expansions
-
-	env := object.NewEnvironment(nil) // shared scope across all REPL statements evaluation
+	writer := bufio.NewWriter(out)
+	defer writer.Flush()
+	previousOutput := object.Output
+	object.Output = limitOutput(writer)
+	defer func() { object.Output = previousOutput }()
 
-	symTable := compiler.NewSymbolTable(nil)
-	constantPool := make([]object.Object, 0)
-	globals := make([]object.Object, 100)
-
-	multilineMode := false
-	var buffer []string // Stores multi-line input
+	s := newSession(writer, engine)
+	var lines lineBuffer
 
 	for {
 
@@ -42,7 +57,7 @@ func Start(in io.Reader, out io.Writer, engine string) {
 		if errors.Is(err, readline.ErrInterrupt) {
 			// Ctrl+C was pressed: Clear input and continue
 			fmt.Println("KeyboardInterrupt")
-			multilineMode = false
+			lines.reset()
 			rl.SetPrompt(prompt) // restore original prompt
 			continue
 		} else if err == io.EOF {
@@ -59,63 +74,162 @@ func Start(in io.Reader, out io.Writer, engine string) {
 			return
 		}
 
-		buffer = append(buffer, line)
-		if isCompleteStatement(line, multilineMode) {
-			multilineMode = false
-			rl.SetPrompt(prompt) // restore original prompt
-		} else {
-			multilineMode = true
+		input, complete := lines.add(line)
+		if !complete {
 			rl.SetPrompt("..") // Change prompt for multi-line
 			continue
 		}
+		rl.SetPrompt(prompt) // restore original prompt
 
-		input := strings.Join(buffer, "\n")
-		buffer = nil // Reset buffer
-		l := lexer.New(input)
-		p := parser.New(l)
-		prg := p.ParseProgram()
-		if len(p.Errors) != 0 {
-			for _, msg := range p.Errors {
-				_, _ = io.WriteString(out, msg+"\n")
-			}
-			continue
+		s.run(input)
+		_ = writer.Flush()
+	}
+}
+
+// limitOutput caps the output of builtins written to w at MaxOutput bytes, if set.
+func limitOutput(w io.Writer) io.Writer {
+	if MaxOutput > 0 {
+		return object.LimitOutput(w, MaxOutput)
+	}
+	return w
+}
+
+// lineBuffer collects the lines of an input spanning several lines, like a function or macro definition.
+type lineBuffer struct {
+	lines     []string
+	multiline bool // a line left the input incomplete, it goes on until an empty line
+}
+
+// add appends line to the input and reports whether it is complete, returning the whole input if it is. The buffer is
+// then emptied for the next input.
+func (b *lineBuffer) add(line string) (string, bool) {
+	b.lines = append(b.lines, line)
+	if !isCompleteStatement(line, b.multiline) {
+		b.multiline = true
+		return "", false
+	}
+	input := strings.Join(b.lines, "\n")
+	b.reset()
+	return input, true
+}
+
+// reset drops the lines of an unfinished input.
+func (b *lineBuffer) reset() {
+	b.lines = nil
+	b.multiline = false
+}
+
+// lastResult is the name the result of the previous input is bound to.
+const lastResult = "_"
+
+// session holds the state shared by all inputs of a REPL session.
+type session struct {
+	out    io.Writer
+	engine string
+
+	macroEnv *object.Environment // shared scope across all macro expansions
+	env      *object.Environment // shared scope across all REPL statements evaluation
+
+	symTable     *compiler.SymbolTable
+	constantPool []object.Object
+	globals      []object.Object
+}
+
+func newSession(out io.Writer, engine string) *session {
+	return &session{
+		out:          out,
+		engine:       engine,
+		macroEnv:     object.NewEnvironment(nil),
+		env:          object.NewEnvironment(nil),
+		symTable:     compiler.NewSymbolTable(nil),
+		constantPool: make([]object.Object, 0),
+		globals:      make([]object.Object, vm.GlobalsSize),
+	}
+}
+
+// run executes input and writes its result or errors to out, after any output it buffered.
+func (s *session) run(input string) {
+	out := s.out
+	l := lexer.New(input)
+	p := parser.New(l)
+	prg := p.ParseProgram()
+	if len(p.Errors) != 0 {
+		for _, msg := range p.Errors {
+			_, _ = io.WriteString(out, msg+"\n")
 		}
+		return
+	}
+
+	resolvedAST, err := module.Resolve(prg, "")
+	if err != nil {
+		_, _ = io.WriteString(out, err.Error()+"\n")
+		return
+	}
 
-		expandedAST, err := evaluator.ExpandMacro(prg, macroEnv)
+	expandedAST, err := evaluator.ExpandMacro(resolvedAST, s.macroEnv)
+	if err != nil {
+		_, _ = io.WriteString(out, err.Error()+"\n")
+		return
+	}
+
+	var obj object.Object
+	if s.engine == "eval" {
+		evaluator.Strict = Strict
+		obj = evaluator.Eval(expandedAST, s.env)
+		if object.IsErrorValue(obj) {
+			// reported like the errors of the vm, without the ERROR: prefix of the error object
+			_, _ = io.WriteString(out, obj.(*object.Error).Message+"\n")
+			return
+		}
+	} else if s.engine == "vm" {
+		// compiled against a copy of the symbol table, so the names hoisted by an input that fails to compile are dropped
+		symTable := s.symTable.Clone()
+		options := []compiler.Option{compiler.WithSymbolTable(symTable), compiler.WithConstantPool(s.constantPool),
+			compiler.WithLateGlobals()}
+		vmOptions := []vm.StackVMOption{vm.WithGlobals(s.globals)}
+		if Strict {
+			options = append(options, compiler.WithStrict())
+			vmOptions = append(vmOptions, vm.WithStrict())
+		}
+		compiler := compiler.New(options...)
+		err = compiler.Compile(expandedAST)
 		if err != nil {
 			_, _ = io.WriteString(out, err.Error()+"\n")
-			continue
+			return
 		}
+		s.symTable = symTable
 
-		var obj object.Object
-		if engine == "eval" {
-			obj = evaluator.Eval(expandedAST, env)
-		} else if engine == "vm" {
-			compiler := compiler.New(compiler.WithSymbolTable(symTable), compiler.WithConstantPool(constantPool))
-			err = compiler.Compile(expandedAST)
-			if err != nil {
-				_, _ = io.WriteString(out, err.Error()+"\n")
-				continue
-			}
-
-			bytecode := compiler.Output()
-			constantPool = bytecode.ConstantPool // updates shared constant pool
-			vm := vm.NewStackVM(bytecode.Instructions, bytecode.ConstantPool, vm.WithGlobals(globals))
-			err = vm.Run()
-			if err != nil {
-				_, _ = io.WriteString(out, err.Error()+"\n")
-				continue
-			}
-			obj = vm.Top()
+		bytecode := compiler.Output()
+		s.constantPool = bytecode.ConstantPool // updates shared constant pool
+		vmOptions = append(vmOptions, vm.WithSourceMap(bytecode.SourceMap))
+		vm := vm.NewStackVM(bytecode.Instructions, bytecode.ConstantPool, vmOptions...)
+		err = vm.Run()
+		if err != nil {
+			_, _ = io.WriteString(out, err.Error()+"\n")
+			return
 		}
+		obj = vm.Top()
+	}
 
-		if obj != nil {
-			_, _ = io.WriteString(out, obj.Inspect())
-			_, _ = io.WriteString(out, "\n")
+	if obj != nil {
+		_, _ = io.WriteString(out, object.InspectTruncated(obj, MaxDisplay))
+		_, _ = io.WriteString(out, "\n")
+		if obj != object.NULL {
+			s.setLast(obj)
 		}
 	}
 }
 
+// setLast binds obj, the result of the last input, to _ so the next inputs can refer to it.
+func (s *session) setLast(obj object.Object) {
+	if s.engine == "eval" {
+		s.env.Set(lastResult, obj)
+	} else if s.engine == "vm" {
+		symbol := s.symTable.Define(lastResult)
+		s.globals[symbol.Index] = obj
+	}
+}
+
 func isCompleteStatement(line string, multilineMode bool) bool {
 	if !multilineMode {
 		lex := lexer.New(line)
@@ -132,7 +246,7 @@ func isCompleteStatement(line string, multilineMode bool) bool {
 	}
 
 	// Inside multiline mode
-	if line == "" { // Exit multiline mode when user presses RET on empty line
+	if strings.TrimSpace(line) == "" { // Exit multiline mode when user presses RET on an empty line
 		return true
 	}
 
@@ -0,0 +1,312 @@
+package repl
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"github.com/jatin-malik/yal/object"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestSessionOutputOrder(t *testing.T) {
+	inputs := []string{
+		`let greet = fn(name) { puts("hello " + name); len(name) };`,
+		`puts("first"); greet("yal")`,
+		`print("no newline", {"end": ""}); 42`,
+	}
+	expected := "first\nhello yal\n3\nno newline42\n"
+
+	for _, engine := range []string{"vm", "eval"} {
+		t.Run(engine, func(t *testing.T) {
+			var buf bytes.Buffer
+			writer := bufio.NewWriter(&buf)
+			object.Output = writer
+			defer func() { object.Output = os.Stdout }()
+
+			s := newSession(writer, engine)
+			for _, input := range inputs {
+				s.run(input)
+				_ = writer.Flush()
+			}
+
+			if buf.String() != expected {
+				t.Errorf("expected %q, got %q", expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestSessionBufferedOutputOrder(t *testing.T) {
+	defer func() { object.Output, object.BufferOutput = os.Stdout, false }()
+	object.BufferOutput = true
+
+	for _, engine := range []string{"vm", "eval"} {
+		t.Run(engine, func(t *testing.T) {
+			var buf bytes.Buffer
+			object.Output = &buf
+
+			s := newSession(&buf, engine)
+			s.run(`puts("a"); "b"`)
+			s.run(`let f = fn() { print("c", {"end": ""}); puts("d"); 1 }; f() + f()`)
+
+			if expected := "a\nb\ncd\ncd\n2\n"; buf.String() != expected {
+				t.Errorf("expected %q, got %q", expected, buf.String())
+			}
+		})
+	}
+}
+
+// TestSessionEnginesAgree runs the same inputs through a session of each engine, expecting the same output.
+func TestSessionEnginesAgree(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		// redefining a global seen by a function
+		{`let x = 1;`, ""},
+		{`let getX = fn() { x };`, ""},
+		{`getX()`, "1\n"},
+		{`let x = 2;`, ""},
+		{`getX()`, "2\n"},
+
+		// redefining a function called by another one
+		{`let f = fn() { 1 };`, ""},
+		{`let g = fn() { f() };`, ""},
+		{`let f = fn() { 2 };`, ""},
+		{`g()`, "2\n"},
+
+		// a let shadowing a captured variable or the function's own name
+		{`let counter = fn() { let c = 0; fn() { let c = c + 1; c } };`, ""},
+		{`let next = counter();`, ""},
+		{`next() + next()`, "2\n"},
+		{`let self = fn() { let self = 5; self };`, ""},
+		{`self()`, "5\n"},
+
+		// closures over globals keep working across inputs
+		{`let adder = fn(a) { fn(b) { a + b + x } };`, ""},
+		{`adder(10)(20)`, "32\n"},
+		{`let rec = fn(n) { if (n == 0) { 0 } else { n + rec(n - 1) } };`, ""},
+		{`rec(4)`, "10\n"},
+
+		// a function referring to a global bound by a later input
+		{`let callHelper = fn() { helper() };`, ""},
+		{`callHelper()`, "Undefined variable \"helper\"\n"},
+		{`let helper = fn() { 7 };`, ""},
+		{`callHelper()`, "7\n"},
+
+		// macros, builtins and errors
+		{`let m = macro(a) { quote(unquote(a) + 1) };`, ""},
+		{`m(x)`, "3\n"},
+		{`let len = fn(a) { 0 };`, ""},
+		{`len("abc")`, "0\n"},
+		{`first(1)`, "first(): type INTEGER not supported\n"},
+		{`let q = 1; let q = q + 1; q`, "2\n"},
+		{`puts(x)`, "2\nnull\n"},
+		{`puts(1) puts(2)`, "1\n2\nnull\n"}, // semicolons are optional in the REPL
+
+		// inputs without a value print nothing
+		{``, ""},
+		{`# only a comment`, ""},
+		{`1; let z = 2;`, ""},
+	}
+
+	outputs := make(map[string][]string)
+	for _, engine := range []string{"vm", "eval"} {
+		var buf bytes.Buffer
+		writer := bufio.NewWriter(&buf)
+		object.Output = writer
+
+		s := newSession(writer, engine)
+		for _, tt := range tests {
+			s.run(tt.input)
+			_ = writer.Flush()
+			outputs[engine] = append(outputs[engine], buf.String())
+			buf.Reset()
+		}
+		object.Output = os.Stdout
+	}
+
+	for i, tt := range tests {
+		if outputs["vm"][i] != tt.expected || outputs["eval"][i] != tt.expected {
+			t.Errorf("%s: expected %q, got %q with vm and %q with eval", tt.input, tt.expected,
+				outputs["vm"][i], outputs["eval"][i])
+		}
+	}
+}
+
+func TestSessionBlocksFreeSlots(t *testing.T) {
+	for _, engine := range []string{"vm", "eval"} {
+		t.Run(engine, func(t *testing.T) {
+			var buf bytes.Buffer
+			s := newSession(&buf, engine)
+			s.globals = s.globals[:10] // so a slot leak shows after a few inputs
+			for i := 0; i < 300; i++ {
+				for _, input := range []string{"do { let a = %d; a }", "match (%d) { n => n }"} {
+					buf.Reset()
+					s.run(fmt.Sprintf(input, i))
+					if expected := fmt.Sprintf("%d\n", i); buf.String() != expected {
+						t.Fatalf("expected %q, got %q", expected, buf.String())
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestSessionFailedCompile(t *testing.T) {
+	var buf bytes.Buffer
+	s := newSession(&buf, "vm")
+	s.run(`let broken = fn() { 1 }; missing`)
+	buf.Reset()
+	s.run(`broken()`)
+
+	// the let of broken never ran, so broken is not defined either
+	if expected := "unknown identifier broken\n"; buf.String() != expected {
+		t.Errorf("expected %q, got %q", expected, buf.String())
+	}
+}
+
+func TestSessionTruncatesResults(t *testing.T) {
+	defer func(max int) { MaxDisplay = max }(MaxDisplay)
+	MaxDisplay = 3
+	input := `let a = []; let i = 0; loop (i < 1000) { let a = push(a, i); let i = i + 1; } a`
+
+	for _, engine := range []string{"vm", "eval"} {
+		t.Run(engine, func(t *testing.T) {
+			var buf bytes.Buffer
+			s := newSession(&buf, engine)
+			s.run(input)
+			s.run(`[a, [1]]`)
+
+			expected := "[0, 1, ..., 999] (len 1000)\n[[0, 1, ..., 999] (len 1000), [1]]\n"
+			if buf.String() != expected {
+				t.Errorf("expected %q, got %q", expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestSessionLimitsOutput(t *testing.T) {
+	defer func(max int) { MaxOutput = max }(MaxOutput)
+	MaxOutput = 5
+	defer func() { object.Output = os.Stdout }()
+
+	for _, engine := range []string{"vm", "eval"} {
+		t.Run(engine, func(t *testing.T) {
+			var buf bytes.Buffer
+			object.Output = limitOutput(&buf)
+			s := newSession(&buf, engine)
+			s.run(`puts("abc")`)
+			s.run(`puts("abc")`)
+
+			expected := "abc\nnull\naoutput limit exceeded\n"
+			if buf.String() != expected {
+				t.Errorf("expected %q, got %q", expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestSessionStrict(t *testing.T) {
+	defer func() { Strict = false }()
+	Strict = true
+
+	for _, engine := range []string{"vm", "eval"} {
+		t.Run(engine, func(t *testing.T) {
+			var buf bytes.Buffer
+			s := newSession(&buf, engine)
+			s.run(`let x = do { if (false) { 1 } };`)
+			s.run(`{"a": 1}["b"]`)
+			s.run(`if (false) { 1 }; 2`)
+
+			expected := "if without else has no value: condition is false\nkey \"b\" not found in hash\n2\n"
+			if buf.String() != expected {
+				t.Errorf("expected %q, got %q", expected, buf.String())
+			}
+		})
+	}
+}
+
+func TestSessionLastResult(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{`2 + 3`, "5\n"},
+		{`_ * 2`, "10\n"},
+		{`_ + 1`, "11\n"},
+		{`let x = 1;`, ""},            // no value, _ is unchanged
+		{`_`, "11\n"},                 // referring to _ keeps it
+		{`_ / 0`, "division by zero"}, // an error leaves _ alone
+		{`puts("a")`, "a\nnull\n"},    // and so does a null
+		{`[_, x]`, "[11, 1]\n"},
+		{`len(_)`, "2\n"},
+	}
+
+	for _, engine := range []string{"vm", "eval"} {
+		t.Run(engine, func(t *testing.T) {
+			var buf bytes.Buffer
+			object.Output = &buf
+			defer func() { object.Output = os.Stdout }()
+
+			s := newSession(&buf, engine)
+			for _, tt := range tests {
+				buf.Reset()
+				s.run(tt.input)
+				if !strings.HasPrefix(strings.ToLower(buf.String()), tt.expected) {
+					t.Errorf("%s: expected %q, got %q", tt.input, tt.expected, buf.String())
+				}
+			}
+		})
+	}
+}
+
+func TestMultilineMacro(t *testing.T) {
+	lines := []string{
+		`let unless = macro(cond, a, b) { # evaluates a unless cond holds`,
+		`  quote(if (!(unquote(cond))) {`,
+		`    unquote(a)`,
+		`  } else { unquote(b) })`,
+		`};`,
+		`  `, // a blank line ends the input
+	}
+
+	for _, engine := range []string{"vm", "eval"} {
+		t.Run(engine, func(t *testing.T) {
+			var buf bytes.Buffer
+			object.Output = &buf
+			defer func() { object.Output = os.Stdout }()
+			s := newSession(&buf, engine)
+
+			var b lineBuffer
+			for i, line := range lines {
+				input, complete := b.add(line)
+				if i < len(lines)-1 {
+					if complete {
+						t.Fatalf("expected line %d %q to continue the input", i+1, line)
+					}
+					continue
+				}
+				if !complete {
+					t.Fatalf("expected the blank line to end the input")
+				}
+				s.run(input)
+			}
+
+			if _, ok := s.macroEnv.Get("unless").(*object.Macro); !ok {
+				t.Fatalf("expected unless to be a macro, got %v", s.macroEnv.Get("unless"))
+			}
+			s.run(`unless(1 > 2, "yes", "no")`)
+			if buf.String() != "yes\n" {
+				t.Errorf("expected %q, got %q", "yes\n", buf.String())
+			}
+
+			// an interrupted input is dropped
+			b.add(`let m = macro(a) {`)
+			b.reset()
+			if input, complete := b.add(`1 + 1`); !complete || input != "1 + 1" {
+				t.Errorf("expected a fresh input after reset, got %q", input)
+			}
+		})
+	}
+}
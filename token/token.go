@@ -21,10 +21,12 @@ const (
 	LBRACE    TokenType = "{"
 	RBRACE    TokenType = "}"
 	COLON     TokenType = ":"
+	DOT       TokenType = "."
 
 	// Double char tokens
-	EQ  TokenType = "=="
-	NEQ TokenType = "!="
+	EQ    TokenType = "=="
+	NEQ   TokenType = "!="
+	ARROW TokenType = "=>"
 
 	// Keywords
 	LET      TokenType = "LET"
@@ -38,6 +40,8 @@ const (
 	TRUE     TokenType = "TRUE"
 	FALSE    TokenType = "FALSE"
 	LOOP     TokenType = "LOOP"
+	IMPORT   TokenType = "IMPORT"
+	DO       TokenType = "DO"
 
 	// Others
 	IDENT   TokenType = "IDENT"
@@ -48,6 +52,8 @@ const (
 type Token struct {
 	Type    TokenType
 	Literal string
+	Line    int // 1-based line the token starts on, 0 if unknown
+	Column  int // 1-based column the token starts on, 0 if unknown
 }
 
 var keywords = map[string]TokenType{
@@ -60,6 +66,8 @@ var keywords = map[string]TokenType{
 	"true":   TRUE,
 	"false":  FALSE,
 	"loop":   LOOP,
+	"import": IMPORT,
+	"do":     DO,
 }
 
 func GetTokenFromName(name string) TokenType {
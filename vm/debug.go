@@ -0,0 +1,98 @@
+package vm
+
+import (
+	"github.com/jatin-malik/yal/object"
+	"github.com/jatin-malik/yal/token"
+)
+
+// FrameState is a snapshot of the active frame, taken by debuggers between steps.
+type FrameState struct {
+	Depth    int             // number of frames below the active one, 0 for the main program
+	IP       int             // offset of the next instruction to execute
+	Position token.Token     // source position of the next instruction, zero if unknown
+	Locals   []object.Object // local slots indexed like OpGetLocal operands, nil until set, empty for the main program
+}
+
+// SetBreakpoint makes Continue stop before the first instruction of source line that follows an instruction of another
+// line. Source positions come from the map set through WithSourceMap and the source map of compiled functions.
+func (svm *StackVM) SetBreakpoint(line int) {
+	if svm.breakpoints == nil {
+		svm.breakpoints = make(map[int]bool)
+	}
+	svm.breakpoints[line] = true
+}
+
+// ClearBreakpoint removes the breakpoint set on source line, if any.
+func (svm *StackVM) ClearBreakpoint(line int) {
+	delete(svm.breakpoints, line)
+}
+
+// Step executes a single instruction. It does nothing once the program is done.
+func (svm *StackVM) Step() error {
+	if svm.Done() {
+		return nil
+	}
+	if tok, ok := svm.position(); ok {
+		svm.line = tok.Line
+	}
+	if _, err := svm.executeInstruction(); err != nil {
+		return svm.positioned(err)
+	}
+	return nil
+}
+
+// StepLine executes instructions until the next one belongs to a source line other than the current one, stepping into
+// calls, or the program is done.
+func (svm *StackVM) StepLine() error {
+	if err := svm.Step(); err != nil {
+		return err
+	}
+	for !svm.Done() {
+		if tok, ok := svm.position(); ok && tok.Line != svm.line {
+			return nil
+		}
+		if err := svm.Step(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Continue executes instructions until a breakpoint is reached or the program is done. It reports whether it stopped at
+// a breakpoint.
+func (svm *StackVM) Continue() (bool, error) {
+	for !svm.Done() {
+		if tok, ok := svm.position(); ok && tok.Line != svm.line && svm.breakpoints[tok.Line] {
+			svm.line = tok.Line
+			return true, nil
+		}
+		if err := svm.Step(); err != nil {
+			return false, err
+		}
+	}
+	return false, nil
+}
+
+// Frame returns the state of the active frame.
+func (svm *StackVM) Frame() FrameState {
+	frame := svm.frames[svm.activeFrameIdx]
+	state := FrameState{Depth: svm.activeFrameIdx, IP: frame.ip}
+	state.Position, _ = svm.position()
+	if svm.activeFrameIdx != 0 {
+		numLocals := frame.closure.Fn.NumLocals
+		state.Locals = append(state.Locals, svm.stack[frame.bp+1:frame.bp+1+numLocals]...)
+	}
+	return state
+}
+
+// Stack returns the objects on the stack, from the bottom up. Local slots reserved by a call are nil until set.
+func (svm *StackVM) Stack() []object.Object {
+	return append([]object.Object(nil), svm.stack[:svm.sp]...)
+}
+
+// position returns the source position of the next instruction of the active frame.
+func (svm *StackVM) position() (token.Token, bool) {
+	frame := svm.frames[svm.activeFrameIdx]
+	tok, ok := frame.closure.Fn.SourceMap[frame.ip]
+	return tok, ok
+}
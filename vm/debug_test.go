@@ -0,0 +1,113 @@
+package vm
+
+import (
+	"testing"
+)
+
+const debugProgram = `let add = fn(a, b) {
+  let sum = a + b;
+  sum * 2
+};
+let x = add(1, 2);
+x + 1`
+
+func newDebugVM(t *testing.T, input string) *StackVM {
+	t.Helper()
+	compiler, err := testCompile(input)
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := compiler.Output()
+	return NewStackVM(code.Instructions, code.ConstantPool, WithSourceMap(code.SourceMap))
+}
+
+func TestDebuggerBreakpoint(t *testing.T) {
+	vm := newDebugVM(t, debugProgram)
+	vm.SetBreakpoint(3)
+
+	stopped, err := vm.Continue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !stopped {
+		t.Fatalf("expected to stop at the breakpoint")
+	}
+
+	frame := vm.Frame()
+	if frame.Position.Line != 3 || frame.Depth != 1 {
+		t.Fatalf("expected to stop at line 3 in a call, got line %d at depth %d", frame.Position.Line, frame.Depth)
+	}
+	if len(frame.Locals) < 3 {
+		t.Fatalf("expected at least 3 local slots, got %d", len(frame.Locals))
+	}
+	// parameters come first and sum is the last local defined
+	for i, expected := range map[int]string{0: "1", 1: "2", len(frame.Locals) - 1: "3"} {
+		if frame.Locals[i] == nil || frame.Locals[i].Inspect() != expected {
+			t.Errorf("expected local %d to be %s, got %v", i, expected, frame.Locals[i])
+		}
+	}
+
+	// the call to add sits at the bottom of the stack, with its arguments
+	stack := vm.Stack()
+	if len(stack) < 3 || stack[1].Inspect() != "1" || stack[2].Inspect() != "2" {
+		t.Errorf("expected the called function and its arguments at the bottom of the stack, got %v", stack)
+	}
+
+	stopped, err = vm.Continue()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stopped || !vm.Done() {
+		t.Fatalf("expected to run to the end")
+	}
+	if vm.Top().Inspect() != "7" {
+		t.Errorf("expected 7, got %s", vm.Top().Inspect())
+	}
+}
+
+func TestDebuggerStepLine(t *testing.T) {
+	vm := newDebugVM(t, debugProgram)
+
+	var lines []int
+	for !vm.Done() {
+		lines = append(lines, vm.Frame().Position.Line)
+		if err := vm.StepLine(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expected := []int{1, 5, 2, 3, 5, 6}
+	if len(lines) != len(expected) {
+		t.Fatalf("expected lines %v, got %v", expected, lines)
+	}
+	for i := range expected {
+		if lines[i] != expected[i] {
+			t.Fatalf("expected lines %v, got %v", expected, lines)
+		}
+	}
+	if vm.Top().Inspect() != "7" {
+		t.Errorf("expected 7, got %s", vm.Top().Inspect())
+	}
+}
+
+func TestDebuggerStep(t *testing.T) {
+	vm := newDebugVM(t, "1 + true")
+
+	for i := 0; i < 2; i++ {
+		if err := vm.Step(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if len(vm.Stack()) != 2 {
+		t.Fatalf("expected both operands on the stack, got %v", vm.Stack())
+	}
+
+	err := vm.Step()
+	posErr, ok := err.(*Error)
+	if !ok {
+		t.Fatalf("expected *Error, got %T: %v", err, err)
+	}
+	if posErr.Token.Line != 1 || posErr.Token.Column != 3 {
+		t.Errorf("expected the error at 1:3, got %d:%d", posErr.Token.Line, posErr.Token.Column)
+	}
+}
@@ -1,11 +1,11 @@
 package vm
 
 import (
-	"encoding/binary"
 	"errors"
 	"fmt"
 	"github.com/jatin-malik/yal/bytecode"
 	"github.com/jatin-malik/yal/object"
+	"github.com/jatin-malik/yal/token"
 )
 
 const (
@@ -21,6 +21,23 @@ var builtInFunctions = []*object.BuiltinFunction{
 	object.BuiltinFunctions["rest"],
 	object.BuiltinFunctions["push"],
 	object.BuiltinFunctions["puts"],
+	object.BuiltinFunctions["print"],
+	object.BuiltinFunctions["match"],
+	object.BuiltinFunctions["find_all"],
+	object.BuiltinFunctions["getenv"],
+	object.BuiltinFunctions["setenv"],
+	object.BuiltinFunctions["args"],
+	object.BuiltinFunctions["clone"],
+	object.BuiltinFunctions["freeze"],
+	object.BuiltinFunctions["arity"],
+	object.BuiltinFunctions["partial"],
+	object.BuiltinFunctions["compose"],
+	object.BuiltinFunctions["pipe"],
+	object.BuiltinFunctions["deepequal"],
+	object.BuiltinFunctions["rjust"],
+	object.BuiltinFunctions["ljust"],
+	object.BuiltinFunctions["flush"],
+	object.BuiltinFunctions["sleep"],
 }
 
 // VM mimics a real machine. It emulates the fetch-decode-execute cycle of a real machine and operates upon bytecode.
@@ -51,6 +68,10 @@ type StackVM struct {
 	activeFrameIdx int
 	constantPool   []object.Object
 	globals        []object.Object
+	strict         bool
+
+	breakpoints map[int]bool // source lines Continue stops at
+	line        int          // source line of the last instruction executed by Step
 
 	stack []object.Object
 	sp    int // sp always points to the next available slot in stack
@@ -65,6 +86,20 @@ func WithGlobals(globals []object.Object) StackVMOption {
 	}
 }
 
+// WithSourceMap sets the source map of the main program, used to report the position of runtime errors.
+func WithSourceMap(sourceMap bytecode.SourceMap) StackVMOption {
+	return func(vm *StackVM) {
+		vm.frames[0].closure.Fn.SourceMap = sourceMap
+	}
+}
+
+// WithStrict makes indexing a hash with a missing key an error instead of producing null.
+func WithStrict() StackVMOption {
+	return func(vm *StackVM) {
+		vm.strict = true
+	}
+}
+
 func NewStackVM(instructions bytecode.Instructions, constantPool []object.Object, options ...StackVMOption) *StackVM {
 	mainClosure := &object.Closure{
 		Fn: &object.CompiledFunction{
@@ -89,157 +124,247 @@ func NewStackVM(instructions bytecode.Instructions, constantPool []object.Object
 	return vm
 }
 
+// Run executes the program. Output that puts and print buffered is flushed before it returns, so it is written before
+// anything the host prints next, like the result. A failed flush of a program that succeeded is reported as its error.
 func (svm *StackVM) Run() error {
-	for svm.frames[svm.activeFrameIdx].ip < len(svm.frames[svm.activeFrameIdx].instructions()) {
-		activeFrame := svm.frames[svm.activeFrameIdx]
+	err := svm.run(-1)
+	if flushErr := object.FlushOutput(); flushErr != nil && err == nil {
+		return flushErr
+	}
+	return err
+}
 
-		opcode := bytecode.OpCode(activeFrame.instructions()[activeFrame.ip]) // Fetch
+// Error is a runtime error reported at the token of the source node whose instruction failed.
+type Error struct {
+	Token   token.Token
+	Message string
+}
 
-		switch opcode { // Decode
-		case bytecode.OpPush:
-			idx := binary.BigEndian.Uint16(activeFrame.instructions()[activeFrame.ip+1:])
-			obj := svm.constantPool[idx]
-			svm.push(obj)
-			activeFrame.ip += 1 + 2
-		case bytecode.OpPushTrue:
-			svm.push(object.TRUE)
-			activeFrame.ip += 1
-		case bytecode.OpPushFalse:
-			svm.push(object.FALSE)
-			activeFrame.ip += 1
-		case bytecode.OpPushNull:
-			svm.push(object.NULL)
-			activeFrame.ip += 1
-		case bytecode.OpAdd, bytecode.OpSub, bytecode.OpMul, bytecode.OpDiv, bytecode.OpEqual, bytecode.OpNotEqual, bytecode.OpGT:
-			err := svm.executeBinaryOperation(opcode)
-			if err != nil {
-				return err
-			}
-			activeFrame.ip += 1
-		case bytecode.OpNegateBoolean, bytecode.OpNegateNumber:
-			err := svm.executeUnaryOperation(opcode)
-			if err != nil {
-				return err
-			}
-			activeFrame.ip += 1
-		case bytecode.OpJumpIfFalse:
-			jumpTo := binary.BigEndian.Uint16(activeFrame.instructions()[activeFrame.ip+1:])
-			if !object.IsTruthy(svm.pop()) {
-				activeFrame.ip = int(jumpTo)
-			} else {
-				activeFrame.ip += 1 + 2
-			}
+func (err *Error) Error() string {
+	return err.Message
+}
+
+// run executes instructions until the program ends or, when returnAt is not negative, until a return leaves the frame
+// at index returnAt active again. Errors are reported as *Error when the source map knows the failing instruction.
+func (svm *StackVM) run(returnAt int) error {
+	if err := svm.execute(returnAt); err != nil {
+		return svm.positioned(err)
+	}
+	return nil
+}
+
+func (svm *StackVM) execute(returnAt int) error {
+	for !svm.Done() {
+		if object.IsInterrupted() {
+			return fmt.Errorf("interrupted")
+		}
+		returned, err := svm.executeInstruction()
+		if err != nil {
+			return err
+		}
+		if returned && svm.activeFrameIdx == returnAt {
+			return nil
+		}
+	}
+	return nil
+}
+
+// positioned attaches the source position of the instruction at the active frame's ip to err when it is known.
+func (svm *StackVM) positioned(err error) error {
+	if _, ok := err.(*Error); ok {
+		return err // raised by a nested run, already positioned
+	}
+	frame := svm.frames[svm.activeFrameIdx]
+	if tok, ok := frame.closure.Fn.SourceMap[frame.ip]; ok {
+		return &Error{Token: tok, Message: err.Error()}
+	}
+	return err
+}
+
+// undefinedGlobalError reports the global read by the instruction at the active frame's ip as undefined, naming it
+// after its source token when the source map knows it.
+func (svm *StackVM) undefinedGlobalError() error {
+	if tok, ok := svm.position(); ok && tok.Type == token.IDENT {
+		return fmt.Errorf("Undefined variable %q", tok.Literal)
+	}
+	return fmt.Errorf("undefined global variable")
+}
+
+// Done reports whether the main program has run to its end.
+func (svm *StackVM) Done() bool {
+	frame := svm.frames[svm.activeFrameIdx]
+	return frame.ip >= len(frame.instructions())
+}
+
+// executeInstruction executes the instruction at the active frame's ip and reports whether it returned from a frame.
+func (svm *StackVM) executeInstruction() (bool, error) {
+	activeFrame := svm.frames[svm.activeFrameIdx]
 
-		case bytecode.OpJump:
-			jumpTo := binary.BigEndian.Uint16(activeFrame.instructions()[activeFrame.ip+1:])
+	opcode := bytecode.OpCode(activeFrame.instructions()[activeFrame.ip]) // Fetch
+
+	switch opcode { // Decode
+	case bytecode.OpPush:
+		idx := bytecode.ReadUint16(activeFrame.instructions()[activeFrame.ip+1:])
+		obj := svm.constantPool[idx]
+		svm.push(obj)
+		activeFrame.ip += 1 + 2
+	case bytecode.OpPushTrue:
+		svm.push(object.TRUE)
+		activeFrame.ip += 1
+	case bytecode.OpPushFalse:
+		svm.push(object.FALSE)
+		activeFrame.ip += 1
+	case bytecode.OpPushNull:
+		svm.push(object.NULL)
+		activeFrame.ip += 1
+	case bytecode.OpPop:
+		svm.pop()
+		activeFrame.ip += 1
+	case bytecode.OpAdd, bytecode.OpSub, bytecode.OpMul, bytecode.OpDiv, bytecode.OpEqual, bytecode.OpNotEqual, bytecode.OpGT:
+		err := svm.executeBinaryOperation(opcode)
+		if err != nil {
+			return false, err
+		}
+		activeFrame.ip += 1
+	case bytecode.OpNegateBoolean, bytecode.OpNegateNumber:
+		err := svm.executeUnaryOperation(opcode)
+		if err != nil {
+			return false, err
+		}
+		activeFrame.ip += 1
+	case bytecode.OpJumpIfFalse:
+		jumpTo := bytecode.ReadUint16(activeFrame.instructions()[activeFrame.ip+1:])
+		if !object.IsTruthy(svm.pop()) {
 			activeFrame.ip = int(jumpTo)
-		case bytecode.OpSetLocal:
-			idx := binary.BigEndian.Uint16(activeFrame.instructions()[activeFrame.ip+1:])
-			localBindingsStackIdx := svm.frames[svm.activeFrameIdx].bp + 1 + int(idx)
-			svm.stack[localBindingsStackIdx] = svm.pop()
-			activeFrame.ip += 1 + 2
-		case bytecode.OpSetGlobal:
-			idx := binary.BigEndian.Uint16(activeFrame.instructions()[activeFrame.ip+1:])
-			svm.globals[idx] = svm.pop()
-			activeFrame.ip += 1 + 2
-		case bytecode.OpGetLocal:
-			idx := binary.BigEndian.Uint16(activeFrame.instructions()[activeFrame.ip+1:])
-			localBindingsStackIdx := svm.frames[svm.activeFrameIdx].bp + 1 + int(idx)
-			obj := svm.stack[localBindingsStackIdx]
-			svm.push(obj)
-			activeFrame.ip += 1 + 2
-		case bytecode.OpGetGlobal:
-			idx := binary.BigEndian.Uint16(activeFrame.instructions()[activeFrame.ip+1:])
-			obj := svm.globals[idx]
-			svm.push(obj)
-			activeFrame.ip += 1 + 2
-		case bytecode.OpGetBuiltIn:
-			idx := int(activeFrame.instructions()[activeFrame.ip+1])
-			obj := builtInFunctions[idx]
-			svm.push(obj)
-			activeFrame.ip += 2
-		case bytecode.OpGetFree:
-			idx := int(activeFrame.instructions()[activeFrame.ip+1])
-			obj := activeFrame.closure.FreeStore[idx]
-			svm.push(obj)
-			activeFrame.ip += 2
-		case bytecode.OpArray:
-			count := binary.BigEndian.Uint16(activeFrame.instructions()[activeFrame.ip+1:])
-			arr := svm.buildArray(int(count))
-			svm.push(arr)
-			activeFrame.ip += 1 + 2
-		case bytecode.OpHash:
-			count := binary.BigEndian.Uint16(activeFrame.instructions()[activeFrame.ip+1:])
-			hash, err := svm.buildHash(int(count))
-			if err != nil {
-				return err
-			}
-			svm.push(hash)
+		} else {
 			activeFrame.ip += 1 + 2
-		case bytecode.OpIndex:
-			idx := svm.pop()
-			iterable := svm.pop()
-			obj, err := evalIndexExpression(iterable, idx)
-			if err != nil {
-				return err
-			}
-			svm.push(obj)
-			activeFrame.ip += 1
-		case bytecode.OpClosure:
-			idx := binary.BigEndian.Uint16(activeFrame.instructions()[activeFrame.ip+1:])
-			compiledFn := svm.constantPool[idx].(*object.CompiledFunction)
-			freeCount := int(activeFrame.instructions()[activeFrame.ip+3])
-
-			freeStore := make([]object.Object, freeCount)
-			for i := 0; i < freeCount; i++ {
-				freeStore[freeCount-1-i] = svm.pop()
-			}
-			closure := &object.Closure{
-				Fn:        compiledFn,
-				FreeStore: freeStore,
-			}
-			svm.push(closure)
-			activeFrame.ip += 1 + 2 + 1
-		case bytecode.OpCall:
-			argsCount := int(activeFrame.instructions()[activeFrame.ip+1])
-			fn := svm.stack[svm.sp-1-argsCount]
-			if closure, ok := fn.(*object.Closure); ok {
-
-				requiredParams := closure.Fn.NumParams
-				if argsCount != requiredParams {
-					return fmt.Errorf("expected %d parameters, got %d args", requiredParams, argsCount)
-				}
-				svm.pushFrame(closure, svm.sp-1-argsCount)
-				svm.sp += closure.Fn.NumLocals
-			} else if builtInFn, ok := fn.(*object.BuiltinFunction); ok {
-				args := make([]object.Object, argsCount)
-				for i := 0; i < argsCount; i++ {
-					args[argsCount-1-i] = svm.pop()
-				}
-				svm.pop() // pops function from stack
-				obj := builtInFn.Fn(args...)
-				if object.IsErrorValue(obj) {
-					return errors.New(obj.(*object.Error).Message)
-				}
-				svm.push(obj)
-			} else {
-				return fmt.Errorf("type: %T not a callable object", fn)
+		}
+
+	case bytecode.OpJump:
+		jumpTo := bytecode.ReadUint16(activeFrame.instructions()[activeFrame.ip+1:])
+		activeFrame.ip = int(jumpTo)
+	case bytecode.OpSetLocal:
+		idx := bytecode.ReadUint16(activeFrame.instructions()[activeFrame.ip+1:])
+		localBindingsStackIdx := svm.frames[svm.activeFrameIdx].bp + 1 + int(idx)
+		svm.stack[localBindingsStackIdx] = svm.pop()
+		activeFrame.ip += 1 + 2
+	case bytecode.OpSetGlobal:
+		idx := bytecode.ReadUint16(activeFrame.instructions()[activeFrame.ip+1:])
+		svm.globals[idx] = svm.pop()
+		activeFrame.ip += 1 + 2
+	case bytecode.OpGetLocal:
+		idx := bytecode.ReadUint16(activeFrame.instructions()[activeFrame.ip+1:])
+		localBindingsStackIdx := svm.frames[svm.activeFrameIdx].bp + 1 + int(idx)
+		obj := svm.stack[localBindingsStackIdx]
+		svm.push(obj)
+		activeFrame.ip += 1 + 2
+	case bytecode.OpGetGlobalOrBuiltIn:
+		idx := bytecode.ReadUint16(activeFrame.instructions()[activeFrame.ip+1:])
+		obj := svm.globals[idx]
+		if obj == nil {
+			obj = builtInFunctions[bytecode.ReadUint8(activeFrame.instructions()[activeFrame.ip+3:])]
+		}
+		svm.push(obj)
+		activeFrame.ip += 1 + 2 + 1
+	case bytecode.OpGetGlobal:
+		idx := bytecode.ReadUint16(activeFrame.instructions()[activeFrame.ip+1:])
+		obj := svm.globals[idx]
+		if obj == nil {
+			// a hoisted global read before its let ran
+			return false, svm.undefinedGlobalError()
+		}
+		svm.push(obj)
+		activeFrame.ip += 1 + 2
+	case bytecode.OpGetBuiltIn:
+		idx := int(bytecode.ReadUint8(activeFrame.instructions()[activeFrame.ip+1:]))
+		obj := builtInFunctions[idx]
+		svm.push(obj)
+		activeFrame.ip += 2
+	case bytecode.OpGetFree:
+		idx := int(bytecode.ReadUint8(activeFrame.instructions()[activeFrame.ip+1:]))
+		obj := activeFrame.closure.FreeStore[idx]
+		svm.push(obj)
+		activeFrame.ip += 2
+	case bytecode.OpArray:
+		count := bytecode.ReadUint16(activeFrame.instructions()[activeFrame.ip+1:])
+		arr := svm.buildArray(int(count))
+		svm.push(arr)
+		activeFrame.ip += 1 + 2
+	case bytecode.OpHash:
+		count := bytecode.ReadUint16(activeFrame.instructions()[activeFrame.ip+1:])
+		hash, err := svm.buildHash(int(count))
+		if err != nil {
+			return false, err
+		}
+		svm.push(hash)
+		activeFrame.ip += 1 + 2
+	case bytecode.OpIndex:
+		idx := svm.pop()
+		iterable := svm.pop()
+		obj, err := evalIndexExpression(iterable, idx, svm.strict)
+		if err != nil {
+			return false, err
+		}
+		svm.push(obj)
+		activeFrame.ip += 1
+	case bytecode.OpClosure:
+		idx := bytecode.ReadUint16(activeFrame.instructions()[activeFrame.ip+1:])
+		compiledFn := svm.constantPool[idx].(*object.CompiledFunction)
+		freeCount := int(bytecode.ReadUint8(activeFrame.instructions()[activeFrame.ip+3:]))
+
+		freeStore := make([]object.Object, freeCount)
+		for i := 0; i < freeCount; i++ {
+			freeStore[freeCount-1-i] = svm.pop()
+		}
+		closure := &object.Closure{
+			Fn:        compiledFn,
+			FreeStore: freeStore,
+		}
+		svm.push(closure)
+		activeFrame.ip += 1 + 2 + 1
+	case bytecode.OpCall:
+		argsCount := int(bytecode.ReadUint8(activeFrame.instructions()[activeFrame.ip+1:]))
+		if err := svm.executeCall(argsCount); err != nil {
+			return false, err
+		}
+		activeFrame.ip += 2
+	case bytecode.OpCallMethod:
+		idx := bytecode.ReadUint16(activeFrame.instructions()[activeFrame.ip+1:])
+		argsCount := int(bytecode.ReadUint8(activeFrame.instructions()[activeFrame.ip+3:]))
+		if err := svm.executeMethodCall(svm.constantPool[idx], argsCount); err != nil {
+			return false, err
+		}
+		activeFrame.ip += 4
+	case bytecode.OpMatch:
+		idx := bytecode.ReadUint16(activeFrame.instructions()[activeFrame.ip+1:])
+		pattern := svm.constantPool[idx].(*object.Pattern)
+		bindings := make(map[string]object.Object)
+		if object.MatchPattern(pattern.Node, svm.pop(), bindings) {
+			for _, name := range pattern.Names {
+				svm.push(bindings[name])
 			}
-			activeFrame.ip += 2
-		case bytecode.OpGetCurrentClosure:
-			closure := svm.frames[svm.activeFrameIdx].closure
-			svm.push(closure)
-			activeFrame.ip += 1
-		case bytecode.OpReturnValue:
-			val := svm.pop()
-			svm.sp = svm.frames[svm.activeFrameIdx].bp // clean up activation record
-			svm.popFrame()
-			svm.push(val)
-		default:
-			return fmt.Errorf("unknown opcode: %d", opcode)
+			svm.push(object.TRUE)
+		} else {
+			svm.push(object.FALSE)
 		}
+		activeFrame.ip += 1 + 2
+	case bytecode.OpError:
+		idx := bytecode.ReadUint16(activeFrame.instructions()[activeFrame.ip+1:])
+		return false, errors.New(svm.constantPool[idx].(*object.String).Value)
+	case bytecode.OpGetCurrentClosure:
+		closure := svm.frames[svm.activeFrameIdx].closure
+		svm.push(closure)
+		activeFrame.ip += 1
+	case bytecode.OpReturnValue:
+		val := svm.pop()
+		svm.sp = svm.frames[svm.activeFrameIdx].bp // clean up activation record
+		svm.popFrame()
+		svm.push(val)
+		return true, nil
+	default:
+		return false, fmt.Errorf("unknown opcode: %d", opcode)
 	}
-	return nil
+	return false, nil
 }
 
 func (svm *StackVM) executeUnaryOperation(opcode bytecode.OpCode) error {
@@ -276,6 +401,17 @@ func (svm *StackVM) executeBinaryOperation(opcode bytecode.OpCode) error {
 	right := svm.pop()
 	left := svm.pop()
 
+	// string * int repeats the string, the only operation mixing types
+	if str, ok := left.(*object.String); ok && opcode == bytecode.OpMul {
+		if count, ok := right.(*object.Integer); ok {
+			repeated, err := str.Repeat(count.Value)
+			if err != nil {
+				return err
+			}
+			return svm.push(repeated)
+		}
+	}
+
 	// check for type mismatch
 	if left.Type() != right.Type() {
 		return fmt.Errorf("incompatible types: %s and %s", left.Type(), right.Type())
@@ -366,6 +502,8 @@ func (svm *StackVM) executeEqualsBinaryOperation(left, right object.Object) erro
 		svm.push(getBooleanObject(left.(*object.String).Value == right.(*object.String).Value))
 	case object.BooleanObject:
 		svm.push(getBooleanObject(left == right)) // pointer comparison
+	case object.ArrayObject, object.HashObject:
+		svm.push(getBooleanObject(object.DeepEqual(left, right)))
 	default:
 		return fmt.Errorf("unsupported operand type %s with '=='", left.Type())
 	}
@@ -382,6 +520,8 @@ func (svm *StackVM) executeNotEqualsBinaryOperation(left, right object.Object) e
 		svm.push(getBooleanObject(left.(*object.String).Value != right.(*object.String).Value))
 	case object.BooleanObject:
 		svm.push(getBooleanObject(left != right)) // pointer comparison
+	case object.ArrayObject, object.HashObject:
+		svm.push(getBooleanObject(!object.DeepEqual(left, right)))
 	default:
 		return fmt.Errorf("unsupported operand type %s with '!='", left.Type())
 	}
@@ -455,35 +595,28 @@ func (svm *StackVM) buildArray(count int) object.Object {
 	return &object.Array{Elements: objs}
 }
 
+// buildHash pops count value and key pairs off the stack into a hash. The pairs are set in source order, so a repeated
+// key keeps its last value. On an unhashable key no hash is built and the pairs are still popped.
 func (svm *StackVM) buildHash(count int) (object.Object, error) {
-	pairs := make(map[object.Object]object.Object)
-
-	for count > 0 {
-		pairs[svm.pop()] = svm.pop()
-		count--
-	}
-
-	ho := new(object.Hash)
-	elems := make(map[object.HashKey]object.Object)
-	for k, v := range pairs {
-		// Check if key is hashable
-		if key, ok := k.(object.Hashable); !ok {
-			return nil, fmt.Errorf("key type %s is not hashable", k.Type())
-		} else {
-			hashKey := key.HashKey()
-			elems[hashKey] = v
+	start, end := svm.sp-2*count, svm.sp
+	svm.sp = start
+	ho := object.NewHash()
+	for i := start; i < end; i += 2 {
+		if err := ho.Set(svm.stack[i+1], svm.stack[i]); err != nil {
+			return nil, err
 		}
 	}
-	ho.Pairs = elems
 	return ho, nil
 }
 
-func evalIndexExpression(iterable object.Object, index object.Object) (object.Object, error) {
+func evalIndexExpression(iterable object.Object, index object.Object, strict bool) (object.Object, error) {
 	switch iterable.Type() {
 	case object.ArrayObject:
 		return evalArrayIndexExpression(iterable, index)
 	case object.HashObject:
-		return evalHashIndexExpression(iterable, index)
+		return evalHashIndexExpression(iterable, index, strict)
+	case object.StringObject:
+		return evalStringIndexExpression(iterable, index)
 	default:
 		return nil, fmt.Errorf("index expression not supported for type: %s", iterable.Type())
 	}
@@ -496,28 +629,130 @@ func evalArrayIndexExpression(iterable object.Object, index object.Object) (obje
 	if i, ok := index.(*object.Integer); !ok {
 		return nil, fmt.Errorf("index must be an integer for index expression in arrays")
 	} else {
-		// Check bounds of the index
-		idx := i.Value
-		if idx < 0 || idx >= int64(len(arr.Elements)) {
-			return nil, fmt.Errorf("index %d out of bounds for arr length %d", idx, len(arr.Elements))
-		}
-
-		return arr.Elements[idx], nil
+		return arr.Get(i.Value)
 	}
 
 }
 
-func evalHashIndexExpression(iterable object.Object, index object.Object) (object.Object, error) {
+func evalStringIndexExpression(iterable object.Object, index object.Object) (object.Object, error) {
+	str := iterable.(*object.String)
+
+	// The index has to be an integer
+	if i, ok := index.(*object.Integer); !ok {
+		return nil, fmt.Errorf("index must be an integer for index expression in strings")
+	} else {
+		return str.Get(i.Value)
+	}
+}
+
+func evalHashIndexExpression(iterable object.Object, index object.Object, strict bool) (object.Object, error) {
 	hash := iterable.(*object.Hash)
-	// Check if key is hashable
-	if key, ok := index.(object.Hashable); !ok {
-		return nil, fmt.Errorf("key type %s is not hashable", index.Type())
+	if err := object.CheckKey(index); err != nil {
+		return nil, err
+	}
+	val, ok := hash.Get(index)
+	if !ok {
+		if strict {
+			return nil, fmt.Errorf("key %s not found in hash", object.KeyString(index))
+		}
+		return object.NULL, nil
+	}
+	return val, nil
+}
+
+// executeCall calls the function sitting below argsCount arguments on the stack. A closure gets a new frame that the run
+// loop goes on to execute, every other callable leaves its result on the stack in place of the function and arguments.
+func (svm *StackVM) executeCall(argsCount int) error {
+	fn := svm.stack[svm.sp-1-argsCount]
+	if partial, ok := fn.(*object.Partial); ok {
+		// Replace the partial by its function and slide its bound arguments in front of the call arguments
+		if svm.sp+len(partial.Args) > len(svm.stack) {
+			return fmt.Errorf("stack overflow")
+		}
+		fnIdx := svm.sp - 1 - argsCount
+		copy(svm.stack[fnIdx+1+len(partial.Args):], svm.stack[fnIdx+1:svm.sp])
+		copy(svm.stack[fnIdx+1:], partial.Args)
+		svm.stack[fnIdx] = partial.Fn
+		svm.sp += len(partial.Args)
+		argsCount += len(partial.Args)
+		fn = partial.Fn
+	}
+	if closure, ok := fn.(*object.Closure); ok {
+		requiredParams := closure.Fn.NumParams
+		if argsCount != requiredParams {
+			return fmt.Errorf("expected %d parameters, got %d args", requiredParams, argsCount)
+		}
+		svm.pushFrame(closure, svm.sp-1-argsCount)
+		svm.sp += closure.Fn.NumLocals
+	} else if builtInFn, ok := fn.(*object.BuiltinFunction); ok {
+		args := make([]object.Object, argsCount)
+		for i := 0; i < argsCount; i++ {
+			args[argsCount-1-i] = svm.pop()
+		}
+		svm.pop() // pops function from stack
+		obj := builtInFn.Fn(args...)
+		if object.IsErrorValue(obj) {
+			return errors.New(obj.(*object.Error).Message)
+		}
+		svm.push(obj)
+	} else if pipeline, ok := fn.(*object.Pipeline); ok {
+		args := make([]object.Object, argsCount)
+		for i := 0; i < argsCount; i++ {
+			args[argsCount-1-i] = svm.pop()
+		}
+		svm.pop() // pops pipeline from stack
+		var result object.Object
+		for _, fn := range pipeline.Fns {
+			var err error
+			result, err = svm.callFunction(fn, args)
+			if err != nil {
+				return err
+			}
+			args = []object.Object{result}
+		}
+		svm.push(result)
+	} else if _, ok := fn.(*object.Macro); ok {
+		return errors.New("macros cannot be invoked at runtime; they are expanded at compile time")
 	} else {
-		hashKey := key.HashKey()
-		if val, ok := hash.Pairs[hashKey]; ok {
-			return val, nil
-		} else {
-			return object.NULL, nil
+		return fmt.Errorf("type: %T not a callable object", fn)
+	}
+	return nil
+}
+
+// executeMethodCall calls receiver.name(args), with the function bound to name below the receiver and argsCount
+// arguments on the stack. The receiver is passed as the first argument, unless it is a hash holding name, in which case
+// that member takes the place of the function and is called with the arguments alone.
+func (svm *StackVM) executeMethodCall(name object.Object, argsCount int) error {
+	receiverIdx := svm.sp - 1 - argsCount
+	if hash, ok := svm.stack[receiverIdx].(*object.Hash); ok {
+		if member, ok := hash.Get(name); ok {
+			copy(svm.stack[receiverIdx:], svm.stack[receiverIdx+1:svm.sp])
+			svm.sp--
+			svm.stack[receiverIdx-1] = member
+			return svm.executeCall(argsCount)
+		}
+	}
+	return svm.executeCall(argsCount + 1)
+}
+
+// callFunction calls fn with args to completion and returns its result, running the frame of a closure in a nested run
+// loop.
+func (svm *StackVM) callFunction(fn object.Object, args []object.Object) (object.Object, error) {
+	if svm.sp+1+len(args) > len(svm.stack) {
+		return nil, fmt.Errorf("stack overflow")
+	}
+	svm.push(fn)
+	for _, arg := range args {
+		svm.push(arg)
+	}
+	callerFrameIdx := svm.activeFrameIdx
+	if err := svm.executeCall(len(args)); err != nil {
+		return nil, err
+	}
+	if svm.activeFrameIdx != callerFrameIdx {
+		if err := svm.run(callerFrameIdx); err != nil {
+			return nil, err
 		}
 	}
+	return svm.pop(), nil
 }
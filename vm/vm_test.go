@@ -1,12 +1,17 @@
 package vm
 
 import (
-	"encoding/binary"
+	"bytes"
 	"fmt"
+	"github.com/jatin-malik/yal/ast"
 	"github.com/jatin-malik/yal/bytecode"
 	"github.com/jatin-malik/yal/evaluator"
+	"io"
+	"os"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/jatin-malik/yal/compiler"
 	"github.com/jatin-malik/yal/lexer"
@@ -86,6 +91,23 @@ func TestPrefixExpressions(t *testing.T) {
 		{"!!1", "true"},
 		{"!!0", "true"},
 
+		// ! uses truthiness: only false and null are falsy, so 0, "" and empty collections are truthy
+		{`!0`, "false"},
+		{`!-1`, "false"},
+		{`!""`, "false"},
+		{`!"false"`, "false"},
+		{`![]`, "false"},
+		{`![false]`, "false"},
+		{`!{}`, "false"},
+		{`!fn() { false }`, "false"},
+		{`!len`, "false"},
+		{`!if (false) { 1 }`, "true"},
+		{`!{"a": 1}.b`, "true"},
+		{`!!if (false) { 1 }`, "false"},
+		{`!!0`, "true"},
+		{`!!""`, "true"},
+		{`!![]`, "true"},
+
 		// Negative expressions
 		{"-5", "-5"},
 		{"-(-5)", "5"},
@@ -136,6 +158,15 @@ func TestStrings(t *testing.T) {
 		{`"hello" + " " + "world"`, "hello world"},
 		{`"foo" + "bar"`, "foobar"},
 		{`"Go" + "lang"`, "Golang"},
+
+		// String repetition
+		{`"ab" * 3`, "ababab"},
+		{`"x" * 0`, ""},
+		{`"x" * -2`, ""},
+		{`let s = "-"; s * 2 + ">"`, "-->"},
+		{`3 * "ab"`, "error: incompatible types: INTEGER and STRING"},
+		{`"ab" * 9223372036854775807`,
+			"error: string too long: repeating 2 bytes 9223372036854775807 times exceeds 134217728 bytes"},
 	}
 
 	runTests(t, tests)
@@ -157,6 +188,23 @@ func TestArraysAndIndexExpressions(t *testing.T) {
 	runTests(t, tests)
 }
 
+func TestStringIndexExpressions(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{`"hello"[0]`, "h"},
+		{`"héllo"[1]`, "é"},
+		{`"héllo"[2]`, "l"},
+		{`"日本語"[2]`, "語"},
+		{`let s = "héllo"; s[len(s) - 1]`, "o"},
+		{`"héllo"[5]`, "error: index 5 out of bounds for string length 5"},
+		{`"héllo"[-1]`, "error: index -1 out of bounds for string length 5"},
+		{`"hello"["a"]`, "error: index must be an integer for index expression in strings"},
+	}
+
+	runTests(t, tests)
+}
+
 // Hash Literals
 func TestHashLiterals(t *testing.T) {
 	tests := []struct {
@@ -167,6 +215,71 @@ func TestHashLiterals(t *testing.T) {
 		{`let h = {"a": 1, "b": 2}; h["b"]`, "2"},
 		{`{"x": 10, "y": 20}["y"]`, "20"},
 		{`let m = {1: "one", 2: "two"}; m[1]`, "one"},
+		{`{"a": 1}.a`, "1"},
+		{`let h = {"person": {"name": "Alice"}}; h.person.name`, "Alice"},
+		{`let h = {"add": fn(a, b) { a + b }}; h.add(1, 2)`, "3"},
+		{`{"a": 1}.b`, "null"},
+		{`{"a": 1, "a": 2}["a"]`, "2"},
+		{`{"a": 1, "b": 2, "a": 3}["a"]`, "3"},
+		{`let h = {1: "x", 1: "y"}; h[1]`, "y"},
+		{`let null = if (false) { 0 }; {null: "x"}[null]`, "x"},
+		{`let null = {}.missing; {null: "x", "null": "y"}[null]`, "x"},
+		{`let null = if (false) { 0 }; {"null": "y"}[null]`, "null"},
+		{`let f = fn(x) { x }; {f: 1}`, "error: key type FUNCTION is not hashable"},
+		{`let f = fn(x) { x }; {"a": 1}[f]`, "error: key type FUNCTION is not hashable"},
+		{`let f = fn(x) { x }; let h = {"a": 1, f: 2}; h`, "error: key type FUNCTION is not hashable"},
+		{`let g = fn() { 1 }; let f = fn() { g }; {f(): 1}`, "error: key type FUNCTION is not hashable"},
+	}
+
+	runTests(t, tests)
+}
+
+func TestMatchExpressions(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{`match ([1, 2]) { [a, b] => a + b; n => n }`, "3"},
+		{`match ([1, [2, 3]]) { [a, [b, c]] => a + b + c }`, "6"},
+		{`match ({"x": 5, "y": 6}) { {x: x} => x; n => n }`, "5"},
+		{`match ({"x": 5}) { {y: y} => y; {x: x} => x * 2 }`, "10"},
+		{`match (2) { 1 => "one"; 2 => "two"; _ => "many" }`, "two"},
+		{`match (-1) { -1 => "minus one"; _ => "other" }`, "minus one"},
+		{`match (42) { [a] => a; {x: x} => x; n => n + 1 }`, "43"},
+		{`1 + match ([2]) { [a] => a } * 3`, "7"},
+		{`let f = fn(v) { match (v) { [h, t] => h * t; _ => 0 } }; f([3, 4]) + f(1)`, "12"},
+		{`let f = fn(v) { let k = 10; match (v) { [x] => fn() { x + k } } }; f([5])()`, "15"},
+
+		// Scoping
+		{`let a = 1; let r = match ([5]) { [a] => a }; a + r`, "6"},
+		{`let f = fn(a) { let r = match ([5]) { [a] => a }; a + r }; f(1)`, "6"},
+		{`match ([1]) { [a] => a }; a`, "error: unknown identifier a"},
+		{`let f = fn() { match ([1]) { [a] => a }; a }; f()`, "error: unknown identifier a"},
+		{`match ([1, 2]) { [a, 3] => a; [b, a] => a - b }`, "1"},
+
+		{`match (1) { 2 => 2 }`, "error: no pattern matched the value"},
+	}
+
+	runTests(t, tests)
+}
+
+func TestMethodCalls(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{`[1, 2].len()`, "2"},
+		{`[1].push(2)`, "[1, 2]"},
+		{`let arr = [1, 2, 3]; arr.rest().first()`, "2"},
+		{`let h = {"double": fn(x) { x * 2 }}; h.double(4)`, "8"},
+		{`{"len": 5}.len`, "5"},
+		{`1.len()`, "error: len(): type INTEGER not supported"},
+
+		// a hash member named like a builtin is called rather than the builtin
+		{`let m = {"first": fn(x) { x }}; m.first(5)`, "5"},
+		{`let m = {"len": fn() { 7 }}; m.len()`, "7"},
+		{`let f = fn(m) { m.first(1, 2) }; f({"first": fn(a, b) { a + b }})`, "3"},
+		{`{"a": 1, "b": 2}.len()`, "error: len(): type HASH not supported"},
+		{`let len = fn(x) { 42 }; [1].len()`, "42"},
+		{`let f = fn() { let first = fn(x) { 0 }; [1].first() }; f()`, "0"},
 	}
 
 	runTests(t, tests)
@@ -206,6 +319,16 @@ func TestFunctionCalls(t *testing.T) {
 		// Function reassignments
 		{`let f = fn() { 10 }; let f = fn() { 20 }; f()`, "20"},
 
+		// Indexing call results and calling index results
+		{`let getArray = fn() { [10, 20, 30] }; getArray()[0]`, "10"},
+		{`let getArray = fn() { [10, 20, 30] }; getArray()[1 + 1]`, "30"},
+		{`let h = fn() { {"k": "v"} }; h()["k"]`, "v"},
+		{`let arr = [fn() { "first" }, fn(a) { a + 1 }]; arr[0]()`, "first"},
+		{`let arr = [fn() { "first" }, fn(a) { a + 1 }]; arr[1](41)`, "42"},
+		{`let h = fn() { {"double": fn(x) { x * 2 }} }; h()["double"](4)`, "8"},
+		{`let mk = fn() { fn() { [1, [2, 3]] } }; mk()()[1][0]`, "2"},
+		{`let f = fn(n) { [n, n * 2] }; -f(3)[1] + f(1)[0]`, "-5"},
+
 		// Function calls in if-expressions
 		{`let f = fn() { 7 }; if (true) { f() }`, "7"},
 		{`let f = fn() { 8 }; if (false) { f() } else { 12 }`, "12"},
@@ -285,6 +408,10 @@ func TestClosures(t *testing.T) {
 		// Simple closure capturing a variable
 		{`let adder = fn(x) { fn(y) { x + y } }; let addTwo = adder(2); addTwo(3)`, "5"},
 
+		// A let shadowing a captured variable or the function's own name
+		{`let f = fn(c) { fn() { let c = c + 1; let d = c * 2; [c, d] } }; f(1)()`, "[2, 4]"},
+		{`let f = fn() { let f = 5; f }; f()`, "5"},
+
 		// Nested closures capturing outer variables
 		{`let outer = fn(x) { fn(y) { fn(z) { x + y + z } } }; let mid = outer(1); let inner = mid(2); inner(3)`, "6"},
 
@@ -574,6 +701,10 @@ func TestEvalBuiltInFuncLen(t *testing.T) {
 		{`len("good" + "bye" + "!")`, "8"},
 		{`len("a" + "b" + "c")`, "3"},
 
+		// Multi-byte Characters
+		{`len("héllo")`, "5"},
+		{`len("日本語")`, "3"},
+
 		// Other Edge Cases
 		{`len("a" + "")`, "1"},
 		{`len("") + len("test")`, "4"},
@@ -725,6 +856,57 @@ func TestLooping(t *testing.T) {
 			"[0, 1, 2]", // Should store `[0, 1, 2]`
 		},
 
+		// ✅ Return From Inside a Loop Leaves the Function
+		{
+			`
+		let find = fn(arr, target) {
+			let i = 0;
+			loop (i < len(arr)) {
+				if (arr[i] == target) { return i; }
+				let i = i + 1;
+			}
+			return -1;
+		};
+		[find([5, 6, 7], 6), find([5, 6, 7], 9)];
+		`,
+			"[1, -1]",
+		},
+
+		// ✅ Return Skips the Rest of the Function
+		{
+			`
+		let f = fn() {
+			let i = 0;
+			loop (true) {
+				let i = i + 1;
+				if (i == 3) { return i * 10; }
+			}
+			99;
+		};
+		f() + 1;
+		`,
+			"31",
+		},
+
+		// ✅ Return From a Nested Loop
+		{
+			`
+		let f = fn(n) {
+			let i = 0;
+			loop (i < n) {
+				let j = 0;
+				loop (j < n) {
+					if (i * j == 6) { return [i, j]; }
+					let j = j + 1;
+				}
+				let i = i + 1;
+			}
+		};
+		f(4);
+		`,
+			"[2, 3]",
+		},
+
 		// ❌ Loop with Undefined Variable in Condition
 		{
 			`
@@ -744,7 +926,7 @@ func TestLooping(t *testing.T) {
 			let i = i + 1;
 		}
 		`,
-			"error: unknown identifier result",
+			"error: unknown identifier result, did you mean 'rest'?",
 		},
 	}
 
@@ -821,6 +1003,20 @@ func TestEvalBuiltInFuncRest(t *testing.T) {
 	runTests(t, tests)
 }
 
+func TestUnknownIdentifierSuggestions(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{"let total = 10; totl", "error: unknown identifier totl, did you mean 'total'?"},
+		{`lenn("abc")`, "error: unknown identifier lenn, did you mean 'len'?"},
+		{"let f = fn() { let count = 1; cont }; f()", "error: unknown identifier cont, did you mean 'count'?"},
+		{"let total = 10; zebra", "error: unknown identifier zebra"},
+		{"let a = 5; b", "error: unknown identifier b"},
+	}
+
+	runTests(t, tests)
+}
+
 func TestTrickyCases(t *testing.T) {
 	tests := []struct {
 		input, expected string
@@ -867,6 +1063,383 @@ func TestEvalBuiltInFuncPush(t *testing.T) {
 	runTests(t, tests)
 }
 
+func TestEvalBuiltInFuncPrint(t *testing.T) {
+	tests := []struct {
+		input, expected, expectedOutput string
+	}{
+		{`print("a", "b", 1)`, "null", "a b 1\n"},
+		{`print("a", "b", {"sep": ", "})`, "null", "a, b\n"},
+		{`print("a", "b", {"end": "!"})`, "null", "a b!"},
+		{`print(1, 2, 3, {"sep": "-", "end": ""})`, "null", "1-2-3"},
+		{`print("a", {"sep": 1})`, "error: print(): option sep must be a STRING, got INTEGER", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			var out bytes.Buffer
+			object.Output = &out
+			defer func() { object.Output = os.Stdout }()
+
+			runTests(t, []struct{ input, expected string }{{tt.input, tt.expected}})
+			if out.String() != tt.expectedOutput {
+				t.Errorf("expected output %q, got %q", tt.expectedOutput, out.String())
+			}
+		})
+	}
+}
+
+func TestEvalBuiltInFuncMatch(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{`match("abc123", "[0-9]+")`, "true"},
+		{`match("abc", "^[0-9]+$")`, "false"},
+		{`match("2024", "^[0-9]+$")`, "true"},
+		{`match("abc", "(")`, "error: match(): invalid pattern: error parsing regexp: missing closing ): `(`"},
+		{`match("abc")`, "error: match() requires 2 arguments. got 1"},
+		{`match(1, "[0-9]")`, "error: match(): type INTEGER not supported"},
+	}
+
+	runTests(t, tests)
+}
+
+func TestEvalBuiltInFuncFindAll(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{`find_all("the quick brown fox", "[a-z]+")`, "[the, quick, brown, fox]"},
+		{`find_all("a1b22c333", "[0-9]+")`, "[1, 22, 333]"},
+		{`find_all("abc", "[0-9]+")`, "[]"},
+		{`len(find_all("one, two, three", "\w+"))`, "3"},
+		{`find_all("abc", "[")`, "error: find_all(): invalid pattern: error parsing regexp: missing closing ]: `[`"},
+	}
+
+	runTests(t, tests)
+}
+
+func TestEvalBuiltInFuncClone(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{`clone([1, [2, 3]])`, "[1, [2, 3]]"},
+		{`let a = [1]; let b = push(clone(a), 2); a`, "[1]"},
+		{`clone({"a": [1]})["a"]`, "[1]"},
+		{`clone(5)`, "5"},
+		{`clone()`, "error: clone() requires 1 argument. got 0"},
+	}
+
+	runTests(t, tests)
+}
+
+func TestEvalBuiltInFuncFreeze(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{`let a = freeze([1]); push(a, 2)`, "error: cannot modify frozen value"},
+		{`let a = [1]; freeze(a); push(a, 2)`, "error: cannot modify frozen value"},
+		{`let a = freeze([1, 2]); a[1]`, "2"},
+		{`freeze({"a": 1}).a`, "1"},
+		{`push(clone(freeze([1])), 2)`, "[1, 2]"},
+		{`freeze()`, "error: freeze() requires 1 argument. got 0"},
+	}
+
+	runTests(t, tests)
+}
+
+func TestEvalBuiltInFuncArity(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{`arity(fn(x, y) {})`, "2"},
+		{`arity(fn() { 1 })`, "0"},
+		{`let add = fn(a, b, c) { a + b + c }; arity(add)`, "3"},
+		{`let make = fn() { let k = 1; fn(x) { x + k } }; arity(make())`, "1"},
+		{`arity(1)`, "error: arity(): type INTEGER not supported"},
+		{`arity(len)`, "error: arity(): type BUILTIN_FUNCTION not supported"},
+	}
+
+	runTests(t, tests)
+}
+
+func TestEvalBuiltInFuncPartial(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{`let add = fn(a, b) { a + b }; partial(add, 5)(3)`, "8"},
+		{`let add = fn(a, b) { a + b }; let inc = partial(add, 1); inc(inc(1))`, "3"},
+		{`let sub = fn(a, b, c) { a - b - c }; partial(partial(sub, 10), 2)(3)`, "5"},
+		{`let add = fn(a, b) { a + b }; partial(add, 1, 2)()`, "3"},
+		{`let add = fn(a, b) { a + b }; 1 + partial(add, 2)(3) * 2`, "11"},
+		{`let f = fn(x) { let g = partial(fn(a, b) { a * b }, x); g(x) }; f(4)`, "16"},
+		{`partial(push, [1])(2)`, "[1, 2]"},
+		{`let add = fn(a, b) { a + b }; arity(partial(add, 5))`, "1"},
+		{`let add = fn(a, b) { a + b }; partial(add, 5)(3, 4)`, "error: expected 2 parameters, got 3 args"},
+		{`partial(1, 2)`, "error: partial(): type INTEGER not supported"},
+	}
+
+	runTests(t, tests)
+}
+
+func TestEvalBuiltInFuncComposeAndPipe(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{`let inc = fn(x) { x + 1 }; let dbl = fn(x) { x * 2 }; compose(inc, dbl)(3)`, "7"},
+		{`let inc = fn(x) { x + 1 }; let dbl = fn(x) { x * 2 }; pipe(inc, dbl)(3)`, "8"},
+		{`let inc = fn(x) { x + 1 }; let dbl = fn(x) { x * 2 }; compose(inc, compose(dbl, inc))(1)`, "5"},
+		{`let inc = fn(x) { x + 1 }; let f = pipe(inc, inc); [f(1), f(f(1))]`, "[3, 5]"},
+		{`let inc = fn(x) { x + 1 }; let add = fn(a, b) { a + b }; pipe(add, inc)(2, 3)`, "6"},
+		{`let inc = fn(x) { x + 1 }; pipe(rest, len)([1, 2, 3])`, "2"},
+		{`pipe(rest, len)([1, 2, 3])`, "2"},
+		{`let inc = fn(x) { x + 1 }; pipe(inc, len)(1)`, "error: len(): type INTEGER not supported"},
+		{`compose(fn(x) { x }, 1)`, "error: compose(): type INTEGER not supported"},
+		{`pipe(fn(x) { x })`, "error: pipe() requires 2 arguments. got 1"},
+		{`let add = fn(a, b) { a + b }; let f = fn(x) { pipe(partial(add, x), fn(y) { y * x })(1) }; 1 + f(3)`, "13"},
+	}
+
+	runTests(t, tests)
+}
+
+func TestEvalBuiltInFuncDeepEqual(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{`deepequal([1, [2, 3]], [1, [2, 3]])`, "true"},
+		{`deepequal([1, [2, 3]], [1, [2, 4]])`, "false"},
+		{`deepequal([1, 2], [1, 2, 3])`, "false"},
+		{`deepequal({"a": [1], "b": {"c": true}}, {"b": {"c": true}, "a": [1]})`, "true"},
+		{`deepequal({"a": 1}, {"a": 2})`, "false"},
+		{`deepequal({"a": 1}, {"b": 1})`, "false"},
+		{`deepequal(1, "1")`, "false"},
+		{`deepequal([1], {1: 1})`, "false"},
+		{`deepequal([], [])`, "true"},
+		{`[1, [2]] == [1, [2]]`, "true"},
+		{`[1, [2]] != [1, [2]]`, "false"},
+		{`{"a": [1, 2]} == {"a": [1, 2]}`, "true"},
+		{`{"a": [1, 2]} != {"a": [2, 1]}`, "true"},
+		{`let a = [1, 2]; let b = push(a, 3); a == b`, "false"},
+		{`deepequal(1)`, "error: deepequal() requires 2 arguments. got 1"},
+	}
+
+	runTests(t, tests)
+}
+
+// Top level let names are hoisted, a global can be referred to before its definition as long as it is only read after
+func TestForwardReferences(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{`let f = fn() { g() + 1 }; let g = fn() { 41 }; f()`, "42"},
+		{`let isEven = fn(n) { if (n == 0) { true } else { isOdd(n - 1) } }; let isOdd = fn(n) { if (n == 0) { false } else { isEven(n - 1) } }; isEven(10)`, "true"},
+		{`let f = fn() { limit * 2 }; let limit = 5; f()`, "10"},
+		{`let f = fn() { g() }; f(); let g = fn() { 1 };`, "error: Undefined variable \"g\""},
+		{`x + 1; let x = 2;`, "error: Undefined variable \"x\""},
+	}
+
+	runTests(t, tests)
+}
+
+func TestEvalBuiltInFuncJustify(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{`rjust(7, 3)`, "  7"},
+		{`ljust(7, 3) + "|"`, "7  |"},
+		{`rjust("yal", 5)`, "  yal"},
+		{`rjust("héllo", 6)`, " héllo"},
+		{`rjust(12345, 3)`, "12345"},
+		{`rjust(-42, 4)`, " -42"},
+		{`ljust("x", 0)`, "x"},
+		{`let rows = [7, 42, 1234]; let i = 0; let table = ""; loop (i < len(rows)) { let table = table + rjust(rows[i], 5) + "|"; let i = i + 1; } table`, "    7|   42| 1234|"},
+		{`rjust(true, 3)`, "error: rjust(): type BOOLEAN not supported"},
+		{`ljust("a", "3")`, "error: ljust(): width must be an integer, got STRING"},
+		{`rjust(1)`, "error: rjust() requires 2 arguments. got 1"},
+		{`rjust(1, 9223372036854775807)`, "error: rjust(): width 9223372036854775807 exceeds 134217728"},
+		{`ljust("a", 134217729)`, "error: ljust(): width 134217729 exceeds 134217728"},
+	}
+
+	runTests(t, tests)
+}
+
+// A let of a builtin name shadows the builtin from there on, the builtin is unaffected in other scopes and programs
+func TestProgramWithoutValue(t *testing.T) {
+	defer func(previous io.Writer) { object.Output = previous }(object.Output)
+	object.Output = io.Discard
+
+	inputs := []string{
+		"",
+		"  \n\t",
+		"# nothing to run",
+		"# one\n# two\n",
+		"1; let x = 2;",
+		"puts(1); let i = 0; loop (i < 2) { let i = i + 1; }",
+		"let m = macro(a) { a };",
+	}
+
+	for _, input := range inputs {
+		t.Run(input, func(t *testing.T) {
+			obj, err := testVM(input, DEBUG)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if obj != nil {
+				t.Errorf("expected no value, got %s", obj.Inspect())
+			}
+		})
+	}
+
+	runTests(t, []struct{ input, expected string }{
+		{"1; # the last statement is the value", "1"},
+		{"1; 2; 3", "3"},
+	})
+}
+
+func TestDoExpressions(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{`let y = do { let a = 2; a * 3 }; y`, "6"},
+		{`let a = 100; let y = do { let a = 2; a }; [a, y]`, "[100, 2]"},
+		{`1 + do { 5; 2 } * 10`, "21"},
+		{`let f = fn(x) { let t = do { let x = x + 1; let x = x * 2; x }; [x, t] }; f(1)`, "[1, 4]"},
+		{`let g = fn(n) { let r = do { if (n > 0) { return "early"; } n }; "late" }; [g(1), g(-1)]`, "[early, late]"},
+		{`let f = fn(a) { do { let b = a + 1; fn() { a + b } } }; f(1)()`, "3"},
+		{`let k = do { let secret = 7; fn() { secret } }; k()`, "7"},
+		{`do { let a = 5; }`, "null"},
+		{`do { }`, "null"},
+		{`[do { 1 }, do { 2 }]`, "[1, 2]"},
+		{`do { let a = 1; }; a`, "error: unknown identifier a"},
+
+		// the slots of a block are reused once it ends, unless a function defined in it refers to a global
+		{`let x = do { let a = 1; a }; let y = do { let b = 2; b }; [x, y]`, "[1, 2]"},
+		{`let f = fn() { let x = do { let a = 1; a }; let y = 2; [x, y] }; f()`, "[1, 2]"},
+		{`let k = do { let a = 1; fn() { a } }; let b = do { let c = 2; c }; [k(), b]`, "[1, 2]"},
+		{`let f = fn() { let k = do { let a = 1; fn() { a } }; let b = 2; [k(), b] }; f()`, "[1, 2]"},
+	}
+
+	runTests(t, tests)
+}
+
+func TestShadowedBuiltins(t *testing.T) {
+	tests := []struct {
+		input, expected string
+	}{
+		{`let len = fn(x) { 42 }; len("hi")`, "42"},
+		{`len("hi")`, "2"},
+		{`let a = len("hi"); let len = fn(x) { 42 }; [a, len("hi")]`, "[2, 42]"},
+		{`let f = fn() { let len = fn(x) { 1 }; len("abc") }; [f(), len("abc")]`, "[1, 3]"},
+		{`let first = fn(arr) { last(arr) }; [first([1, 2]), rest([1, 2])]`, "[2, [2]]"},
+		{`let push = 5; push`, "5"},
+		{`let f = fn(s) { len(s) }; let len = fn(s) { 42 }; f("abc")`, "42"},
+	}
+
+	runTests(t, tests)
+}
+
+func TestEvalBuiltInFuncEnv(t *testing.T) {
+	defer fakeEnv(map[string]string{"HOME": "/home/yal", "EMPTY": ""})()
+
+	tests := []struct {
+		input, expected string
+	}{
+		{`getenv("HOME")`, "/home/yal"},
+		{`getenv("EMPTY") == ""`, "true"},
+		{`getenv("MISSING")`, "null"},
+		{`setenv("LANG", "yal"); getenv("LANG")`, "yal"},
+		{`getenv(1)`, "error: getenv(): type INTEGER not supported"},
+		{`setenv("LANG")`, "error: setenv() requires 2 arguments. got 1"},
+	}
+
+	runTests(t, tests)
+}
+
+func TestEvalBuiltInFuncSleep(t *testing.T) {
+	var slept []time.Duration
+	object.Sleep = func(d time.Duration) { slept = append(slept, d) }
+	defer func() { object.Sleep = time.Sleep }()
+
+	tests := []struct {
+		input, expected string
+	}{
+		{`sleep(250)`, "null"},
+		{`let f = fn(ms) { sleep(ms * 2) }; f(5)`, "null"},
+		{`sleep(-1)`, "error: sleep(): negative duration -1"},
+		{`sleep(true)`, "error: sleep(): type BOOLEAN not supported"},
+	}
+
+	runTests(t, tests)
+
+	expected := []time.Duration{250 * time.Millisecond, 10 * time.Millisecond}
+	if !slices.Equal(slept, expected) {
+		t.Errorf("expected sleeps %v, got %v", expected, slept)
+	}
+}
+
+func TestInterrupted(t *testing.T) {
+	polls := 0
+	object.Interrupted = func() bool {
+		polls++
+		return polls > 500
+	}
+	defer func() { object.Interrupted = nil }()
+
+	tests := []struct {
+		input, expected string
+	}{
+		{`let i = 0; loop (i < 10) { let i = i + 1; } i`, "10"}, // fewer instructions than it takes to interrupt
+		{`loop (true) { }`, "error: interrupted"},
+		{`let f = fn(n) { f(n + 1) }; f(0)`, "error: interrupted"},
+		{`1`, "error: interrupted"}, // stays interrupted until Interrupted says otherwise
+	}
+
+	runTests(t, tests)
+}
+
+func TestCallingMacro(t *testing.T) {
+	// macros are expanded before compiling, so no program compiles to a call of one; build the bytecode by hand
+	macro := &object.Macro{Env: object.NewEnvironment(nil), Body: &ast.BlockStatement{}}
+	var instructions bytecode.Instructions
+	for _, ins := range [][]byte{
+		mustMake(t, bytecode.OpPush, 0),
+		mustMake(t, bytecode.OpPush, 1),
+		mustMake(t, bytecode.OpCall, 1),
+	} {
+		instructions = append(instructions, ins...)
+	}
+
+	vm := NewStackVM(instructions, []object.Object{macro, &object.Integer{Value: 1}})
+	err := vm.Run()
+	expected := "macros cannot be invoked at runtime; they are expanded at compile time"
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
+
+func mustMake(t *testing.T, opCode bytecode.OpCode, operands ...int) []byte {
+	ins, err := bytecode.Make(opCode, operands...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return ins
+}
+
+func TestRunFlushesBufferedOutput(t *testing.T) {
+	defer func(previous io.Writer) { object.Output, object.BufferOutput = previous, false }(object.Output)
+	var out bytes.Buffer
+	object.Output, object.BufferOutput = &out, true
+
+	obj, err := testVM(`puts("a"); "b"`, DEBUG)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if out.String() != "a\n" {
+		t.Errorf("expected the output written when Run returns, got %q", out.String())
+	}
+	if obj.Inspect() != "b" {
+		t.Errorf("expected b, got %s", obj.Inspect())
+	}
+}
+
 func TestRecursiveFibonacci(t *testing.T) {
 	tests := []struct {
 		input, expected string
@@ -989,6 +1562,18 @@ func TestMacros(t *testing.T) {
 			invalid("hello")`,
 			"error: incompatible types: STRING and INTEGER",
 		},
+
+		// 7. Macros inside a match subject and arms
+		{`
+			let double = macro(x) { quote(unquote(x) * 2) };
+			match (double(3)) { 6 => double(4); _ => 0 }`,
+			"8",
+		},
+		{`
+			let m = macro(x) { quote(unquote(x) * 2) };
+			match (3) { n => m(n) };`,
+			"6",
+		},
 	}
 
 	runTests(t, tests)
@@ -1014,6 +1599,41 @@ func testCompile(input string) (*compiler.Compiler, error) {
 	return compiler, nil
 }
 
+func TestRuntimeErrorPosition(t *testing.T) {
+	tests := []struct {
+		input          string
+		expectedLine   int
+		expectedColumn int
+	}{
+		{"let x = 1;\nx / 0", 2, 3},
+		{"let f = fn(a) {\n  a + \"b\"\n};\nf(1)", 2, 5},
+		{"let h = {\"a\": 1};\n\n  len(h)", 3, 6},
+		{"[1, 2][\"a\"]", 1, 7},
+		{"let inc = fn(x) {\n  -x\n}; pipe(inc, inc)(true)", 2, 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			compiler, err := testCompile(tt.input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			code := compiler.Output()
+
+			vm := NewStackVM(code.Instructions, code.ConstantPool, WithSourceMap(code.SourceMap))
+			err = vm.Run()
+			posErr, ok := err.(*Error)
+			if !ok {
+				t.Fatalf("expected *Error, got %T: %v", err, err)
+			}
+			if posErr.Token.Line != tt.expectedLine || posErr.Token.Column != tt.expectedColumn {
+				t.Errorf("expected position %d:%d, got %d:%d", tt.expectedLine, tt.expectedColumn,
+					posErr.Token.Line, posErr.Token.Column)
+			}
+		})
+	}
+}
+
 func testVM(input string, debug bool) (object.Object, error) {
 	compiler, err := testCompile(input)
 	if err != nil {
@@ -1037,83 +1657,41 @@ func testVM(input string, debug bool) (object.Object, error) {
 		prettyPrintInstructions(code.Instructions)
 	}
 
-	vm := NewStackVM(code.Instructions, code.ConstantPool)
+	vm := NewStackVM(code.Instructions, code.ConstantPool, WithSourceMap(code.SourceMap))
 	if err := vm.Run(); err != nil {
 		return nil, err
 	}
 	return vm.Top(), nil
 }
 
+// fakeEnv swaps the environment used by getenv and setenv for a controlled map and returns a func restoring it.
+func fakeEnv(env map[string]string) func() {
+	object.LookupEnv = func(name string) (string, bool) {
+		value, ok := env[name]
+		return value, ok
+	}
+	object.SetEnv = func(name, value string) error {
+		env[name] = value
+		return nil
+	}
+	return func() {
+		object.LookupEnv = os.LookupEnv
+		object.SetEnv = os.Setenv
+	}
+}
+
 func prettyPrintInstructions(instructions bytecode.Instructions) {
 	fmt.Println("==Instructions===")
 	for i := 0; i < len(instructions); {
 		opCode := bytecode.OpCode(instructions[i])
-		fmt.Print(opCode.String() + " ")
-
-		switch opCode {
-		case bytecode.OpPush:
-			idx := binary.BigEndian.Uint16(instructions[i+1:])
-			fmt.Println(idx)
-			i += 1 + 2
-		case bytecode.OpPushTrue, bytecode.OpPushFalse, bytecode.OpPushNull, bytecode.OpAdd, bytecode.OpSub,
-			bytecode.OpMul, bytecode.OpDiv, bytecode.OpEqual, bytecode.OpNotEqual, bytecode.OpGT,
-			bytecode.OpNegateBoolean, bytecode.OpNegateNumber, bytecode.OpIndex, bytecode.OpReturnValue,
-			bytecode.OpGetCurrentClosure:
-			i++
-			fmt.Println()
-		case bytecode.OpJumpIfFalse:
-			jumpTo := binary.BigEndian.Uint16(instructions[i+1:])
-			fmt.Println(jumpTo)
-			i += 1 + 2
-		case bytecode.OpJump:
-			jumpTo := binary.BigEndian.Uint16(instructions[i+1:])
-			fmt.Println(jumpTo)
-			i += 1 + 2
-		case bytecode.OpSetLocal:
-			idx := binary.BigEndian.Uint16(instructions[i+1:])
-			fmt.Println(idx)
-			i += 1 + 2
-		case bytecode.OpSetGlobal:
-			idx := binary.BigEndian.Uint16(instructions[i+1:])
-			fmt.Println(idx)
-			i += 1 + 2
-		case bytecode.OpGetLocal:
-			idx := binary.BigEndian.Uint16(instructions[i+1:])
-			fmt.Println(idx)
-			i += 1 + 2
-		case bytecode.OpGetGlobal:
-			idx := binary.BigEndian.Uint16(instructions[i+1:])
-			fmt.Println(idx)
-			i += 1 + 2
-		case bytecode.OpGetBuiltIn:
-			idx := int(instructions[i+1])
-			fmt.Println(idx)
-			i += 1 + 1
-		case bytecode.OpGetFree:
-			idx := int(instructions[i+1])
-			fmt.Println(idx)
-			i += 1 + 1
-		case bytecode.OpArray:
-			count := binary.BigEndian.Uint16(instructions[i+1:])
-			fmt.Println(count)
-			i += 1 + 2
-		case bytecode.OpHash:
-			count := binary.BigEndian.Uint16(instructions[i+1:])
-			fmt.Println(count)
-			i += 1 + 2
-		case bytecode.OpClosure:
-			idx := binary.BigEndian.Uint16(instructions[i+1:])
-			freeCount := int(instructions[i+3])
-			fmt.Println(idx, " ", freeCount)
-			i += 1 + 2 + 1
-		case bytecode.OpCall:
-			argsCount := int(instructions[i+1])
-			fmt.Println(argsCount)
-			i += 2
-		default:
-			fmt.Printf("unknown opcode: %d\n", opCode)
+		def, err := bytecode.Lookup(opCode)
+		if err != nil {
+			fmt.Println(err)
+			break
 		}
-
+		operands, read := bytecode.ReadOperands(def, instructions[i+1:])
+		fmt.Println(def.Name, operands)
+		i += 1 + read
 	}
 	fmt.Println("=========")
 }